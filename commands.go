@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kamermans/github-skyline/pkg/skyline"
+	flag "github.com/spf13/pflag"
+)
+
+// commands are the subcommands, which work on contributions files and take
+// their own flags instead of the skyline options
+var commands = map[string]func(args []string){
+	"merge": mergeCommand,
+	"diff":  diffCommand,
+}
+
+// command returns the subcommand named by the first argument, if any
+func command() func(args []string) {
+	if len(os.Args) < 2 {
+		return nil
+	}
+
+	return commands[os.Args[1]]
+}
+
+func mergeCommand(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	strategyName := flags.String("strategy", "sum", "How to combine the counts of a day that is in several files (sum, max, newest)")
+	output := flags.StringP("output", "o", "-", "File to save the merged contributions to, or - for stdout")
+	name := flags.StringP("username", "u", "", "Username or label of the merged contributions (default: the usernames in the files)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: github-skyline merge [options] FILE FILE...\n\nCombines several contributions files into one.\n\n")
+		flags.PrintDefaults()
+	}
+
+	parseCommandFlags(flags, args)
+
+	if flags.NArg() < 2 {
+		usageError("merge needs at least two contributions files")
+	}
+
+	strategy, err := skyline.ParseMergeStrategy(*strategyName)
+	if err != nil {
+		usageError("%v", err)
+	}
+
+	contribs := make([]*skyline.Contributions, 0, flags.NArg())
+	for _, file := range flags.Args() {
+		c, err := skyline.NewContributionsFromFile(file)
+		if err != nil {
+			fail(err)
+		}
+
+		contribs = append(contribs, c)
+	}
+
+	merged, err := skyline.MergeContributions(strategy, contribs...)
+	if err != nil {
+		fail(err)
+	}
+
+	if *name != "" {
+		merged.Username = *name
+	}
+
+	// Without an output file the JSON goes to stdout, so the summary goes to stderr
+	var summary io.Writer = os.Stdout
+	if *output == "-" {
+		summary = os.Stderr
+		err = merged.WriteJSON(os.Stdout)
+	} else {
+		err = merged.SaveToFile(*output)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Fprintf(summary, "Merged %d files with the %s strategy:\n", len(contribs), strategy)
+	for i, c := range contribs {
+		fmt.Fprintf(summary, "  %s: %s, %s\n", flags.Arg(i), c.Label(), contributionsRange(c))
+	}
+
+	fmt.Fprintf(summary, "Total: %s\n", contributionsRange(merged))
+	if *output != "-" {
+		fmt.Fprintf(summary, "Merged contributions saved to %s\n", *output)
+	}
+}
+
+func diffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Write the changes to stdout as JSON, and the summary to stderr")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: github-skyline diff [options] OLD NEW\n\nShows the days whose counts changed between two contributions files.\n\n")
+		flags.PrintDefaults()
+	}
+
+	parseCommandFlags(flags, args)
+
+	if flags.NArg() != 2 {
+		usageError("diff needs two contributions files")
+	}
+
+	before, err := skyline.NewContributionsFromFile(flags.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+
+	after, err := skyline.NewContributionsFromFile(flags.Arg(1))
+	if err != nil {
+		fail(err)
+	}
+
+	diff := skyline.DiffContributions(before, after)
+
+	var summary io.Writer = os.Stdout
+	if *asJSON {
+		summary = os.Stderr
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			fail(err)
+		}
+	}
+
+	fmt.Fprintf(summary, "Old: %s, %s\n", flags.Arg(0), contributionsRange(before))
+	fmt.Fprintf(summary, "New: %s, %s\n", flags.Arg(1), contributionsRange(after))
+
+	if len(diff.Days) == 0 {
+		fmt.Fprintf(summary, "No days changed\n")
+		return
+	}
+
+	fmt.Fprintf(summary, "%d days changed, %+d contributions:\n", len(diff.Days), diff.NewTotal-diff.OldTotal)
+	for _, day := range diff.Days {
+		fmt.Fprintf(summary, "  %s: %d -> %d (%+d)\n", day.Date, day.Old, day.New, day.Change)
+	}
+}
+
+// parseCommandFlags parses the flags of a subcommand, exiting on --help or an
+// invalid flag
+func parseCommandFlags(flags *flag.FlagSet, args []string) {
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+
+	if err != nil {
+		usageError("%v", err)
+	}
+}
+
+func contributionsRange(c *skyline.Contributions) string {
+	if c.FirstDate == "" {
+		return "no contributions"
+	}
+
+	return fmt.Sprintf("%d contributions between %s and %s", c.TotalContributions, c.FirstDate, c.LastDate)
+}
@@ -2,10 +2,14 @@ package main
 
 // Use pflag instead of flag
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/kamermans/github-skyline/pkg/skyline"
 	flag "github.com/spf13/pflag"
@@ -15,13 +19,49 @@ const (
 	version = "1.1.2"
 )
 
+// Exit codes, so scripts can tell why fetching failed
+const (
+	exitError          = 1
+	exitUsage          = 2
+	exitBadCredentials = 3
+	exitScopes         = 4
+	exitNotFound       = 5
+	exitRateLimited    = 6
+)
+
 var (
 	username          string
+	usernamesFile     string
+	team              string
 	token             string
+	tokenFile         string
+	appID             string
+	appKeyFile        string
+	appInstallation   int64
+	organization      string
+	orgMembers        string
+	sourceName        string
+	sourcePath        string
+	sourceOptions     map[string]string
+	apiURL            string
+	caCertFile        string
+	proxyURL          string
+	parallelism       int
+	useCache          bool
+	cacheDir          string
+	cacheTTL          time.Duration
+	offline           bool
+	typeBreakdown     bool
+	typesList         string
+	privateModeName   string
+	commitTimes       bool
 	saveContribs      bool
+	updateContribs    bool
 	contribsFile      string
+	exportCSV         string
 	trimContribs      bool
 	outputFile        string
+	timezone          string
 	startYear         int
 	endYear           int
 	aspectRatio       string
@@ -32,24 +72,66 @@ var (
 	buildingWidth     float64
 	buildingLength    float64
 	interval          string
+	punchcardVertical bool
+	weekStart         string
+	fillGaps          bool
+	padWeeks          bool
 	font              string
 	openscadPath      string
 	showVersion       bool
 	showVersionRaw    bool
 
+	commandName     string
 	aspectRatioInts [2]int
+	usernames       []string
+	contribTypes    []skyline.ContributionType
+	privateMode     skyline.PrivateMode
+	skylineInterval skyline.Interval
+	seriesOptions   skyline.SeriesOptions
 	outputFileType  skyline.OutputType
 )
 
 func init() {
-	flag.StringVarP(&username, "username", "u", os.Getenv("GITHUB_USERNAME"), "GitHub username")
-	flag.StringVarP(&token, "token", "t", os.Getenv("GITHUB_TOKEN"), "GitHub token")
+	// Subcommands parse their own flags
+	if command() != nil {
+		commandName = os.Args[1]
+		return
+	}
+
+	flag.StringVarP(&sourceName, "source", "S", "", fmt.Sprintf("Where to get contributions from (%s) (default: github with --save or --update, otherwise file)", strings.Join(skyline.SourceNames(), ", ")))
+	flag.StringVar(&sourcePath, "path", "", "File or directory the source reads from (default: the contributions file for the file source)")
+	flag.StringToStringVar(&sourceOptions, "source-opt", nil, "Source specific option as key=value, can be repeated")
+	flag.StringVarP(&username, "username", "u", os.Getenv("GITHUB_USERNAME"), "GitHub username, or several comma separated usernames for a team skyline")
+	flag.StringVar(&usernamesFile, "usernames-file", "", "File with GitHub usernames to combine into a team skyline, one per line")
+	flag.StringVar(&team, "team", "", "Team name shown on a skyline of several users (default: the usernames)")
+	flag.StringVarP(&token, "token", "t", os.Getenv("GITHUB_TOKEN"), "GitHub token, or the token for the source (default: from the gh CLI or ~/.netrc)")
+	flag.StringVar(&tokenFile, "token-file", "", "File to read the GitHub token from")
+	flag.StringVar(&appID, "app-id", "", "Authenticate as an installation of the GitHub App with this ID")
+	flag.StringVar(&appKeyFile, "app-key", "", "PEM file with the private key of the GitHub App")
+	flag.Int64Var(&appInstallation, "app-installation", 0, "ID of the GitHub App installation (default: the one on the organization or user)")
+	flag.StringVar(&organization, "org", "", "Only fetch contributions to repositories owned by this GitHub organization")
+	flag.StringVar(&orgMembers, "org-members", "", "Build a team skyline of every member of this GitHub organization")
+	flag.StringVar(&apiURL, "api-url", os.Getenv("GITHUB_GRAPHQL_URL"), "API URL of the source, for GitHub Enterprise Server use https://HOSTNAME/api/graphql (default \"https://api.github.com/graphql\")")
+	flag.StringVar(&caCertFile, "ca-cert", "", "PEM file with additional CA certificates to trust for the GitHub API")
+	flag.StringVar(&proxyURL, "proxy", "", "Proxy URL for the GitHub API (default from HTTPS_PROXY)")
+	flag.IntVarP(&parallelism, "parallel", "P", 4, "Number of years to fetch from GitHub concurrently")
+	flag.BoolVar(&useCache, "cache", false, "Cache GitHub API responses on disk, so fetching the same years again is faster")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Directory for the response cache (default: github-skyline in the user cache directory)")
+	flag.DurationVar(&cacheTTL, "cache-ttl", skyline.DefaultCacheTTL, "How long cached responses about the current year are used")
+	flag.BoolVar(&offline, "offline", false, "Only use cached GitHub API responses, without making any requests (implies --cache)")
+	flag.BoolVar(&typeBreakdown, "breakdown", false, "Also fetch the per-type breakdown of contributions (requires more requests)")
+	flag.BoolVar(&commitTimes, "commit-times", false, "Also fetch the time of each commit for a punchcard skyline (requires more requests)")
+	flag.StringVar(&privateModeName, "private", "add", "How restricted (private) contributions are shown: add to the building heights, or a separate layer (fetches the breakdown)")
+	flag.StringVar(&typesList, "types", "", "Only use these contribution types, comma separated (commits, issues, pull_requests, reviews, repositories)")
 	flag.BoolVarP(&saveContribs, "save", "s", false, "Save contributions to a file")
+	flag.BoolVarP(&updateContribs, "update", "U", false, "Update the contributions file, only fetching the current year and missing years (implies --save)")
 	flag.StringVarP(&contribsFile, "contributions", "f", "contributions.json", "File to save/load contributions")
+	flag.StringVar(&exportCSV, "export-csv", "", "Export the contributions to a CSV file (or TSV if it ends in .tsv)")
 	flag.BoolVarP(&trimContribs, "trim", "T", true, "Trim years from the start that contain no contributions")
 	flag.StringVarP(&outputFile, "output", "o", "skyline.scad", "Output file (.scad and .stl are supported, but stl requires 'openscad')")
-	flag.IntVarP(&startYear, "start", "b", 0, "Start year")
-	flag.IntVarP(&endYear, "end", "e", 0, "End year")
+	flag.StringVar(&timezone, "timezone", "", "Timezone that breakdowns, commit times and other sources are bucketed into days in (not the GitHub calendar), like Europe/Berlin (default: the local timezone, or the one in the contributions file with --update)")
+	flag.IntVarP(&startYear, "start", "b", 0, "Start year (default: first year with contributions)")
+	flag.IntVarP(&endYear, "end", "e", 0, "End year (default: last year with contributions)")
 	flag.StringVarP(&aspectRatio, "aspect-ratio", "a", "16:4", "Aspect ratio of the skyline")
 	flag.Float64VarP(&baseAngle, "base-angle", "A", 22.5, "Slope of the base walls in degrees")
 	flag.Float64VarP(&baseHeight, "base-height", "h", 5.0, "Height of the base (mm)")
@@ -57,7 +139,11 @@ func init() {
 	flag.Float64VarP(&maxBuildingHeight, "max-building-height", "m", 20.0, "Max building height (mm)")
 	flag.Float64VarP(&buildingWidth, "building-width", "w", 2.0, "Building width (mm)")
 	flag.Float64VarP(&buildingLength, "building-length", "l", 2.0, "Building length (mm)")
-	flag.StringVarP(&interval, "interval", "i", "week", "Interval to use for contributions (day, week)")
+	flag.StringVarP(&interval, "interval", "i", "week", "Interval to use for contributions (day, week, month, quarter, year, a number of days like 14d, or punchcard)")
+	flag.BoolVar(&punchcardVertical, "punchcard-vertical", false, "Lay out a punchcard skyline with a column per weekday and a row per hour")
+	flag.StringVar(&weekStart, "week-start", strings.ToLower(skyline.DefaultSeriesOptions.WeekStart.String()), "First day of the week for the week interval and punchcard; weeks starting on Monday are ISO weeks, use sunday to match the GitHub calendar")
+	flag.BoolVar(&fillGaps, "fill-gaps", skyline.DefaultSeriesOptions.FillGaps, "Add an empty building for every interval without contributions between the first and last date")
+	flag.BoolVar(&padWeeks, "pad-weeks", false, "Extend a day or week skyline to whole weeks, with empty buildings for the days added")
 	flag.StringVarP(&font, "font", "F", "Liberation Sans:style=Bold", "Font to use for text")
 	flag.StringVarP(&openscadPath, "openscad", "O", "openscad", "Path to the OpenSCAD executable")
 	flag.BoolVarP(&showVersion, "version", "V", false, "Show version")
@@ -74,58 +160,215 @@ func init() {
 		os.Exit(0)
 	}
 
-	if contribsFile == "" && !saveContribs && (username == "" || token == "") {
+	if updateContribs {
+		saveContribs = true
+	}
+
+	if sourceName == "" {
+		sourceName = "file"
+		if saveContribs || orgMembers != "" {
+			sourceName = "github"
+		}
+	}
+
+	if sourceName == "file" && sourcePath == "" {
+		sourcePath = contribsFile
+	}
+
+	usernames = splitUsernames(username)
+	if usernamesFile != "" {
+		data, err := os.ReadFile(usernamesFile)
+		if err != nil {
+			usageError("invalid usernames file: %v", err)
+		}
+
+		usernames = append(usernames, splitUsernames(string(data))...)
+	}
+
+	usernames = skyline.UniqueUsernames(usernames)
+
+	if team == "" && len(usernames) > 1 {
+		team = strings.Join(usernames, ", ")
+	}
+
+	// The token can also come from a file, a GitHub App, the gh CLI or ~/.netrc
+	if contribsFile == "" && !saveContribs && username == "" {
 		flag.PrintDefaults()
-		panic("username and token are required")
+		usageError("username is required")
 	}
 
 	_, err := fmt.Sscanf(aspectRatio, "%d:%d", &aspectRatioInts[0], &aspectRatioInts[1])
 	if err != nil {
-		panic(fmt.Errorf("invalid aspect ratio: %s; %w", aspectRatio, err))
+		usageError("invalid aspect ratio: %s; %v", aspectRatio, err)
+	}
+
+	contribTypes, err = skyline.ParseContributionTypes(typesList)
+	if err != nil {
+		usageError("%v", err)
+	}
+
+	if len(contribTypes) > 0 {
+		typeBreakdown = true
+	}
+
+	privateMode, err = skyline.ParsePrivateMode(privateModeName)
+	if err != nil {
+		usageError("%v", err)
+	}
+
+	// The restricted contributions by date are estimated from the breakdown
+	if privateMode == skyline.PrivateModeLayer {
+		typeBreakdown = true
+	}
+
+	if (appID == "") != (appKeyFile == "") {
+		usageError("--app-id and --app-key must be used together")
+	}
+
+	// A token file or GitHub App replaces the token from the environment
+	if (tokenFile != "" || appID != "") && !flag.CommandLine.Changed("token") {
+		token = ""
+	}
+
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			usageError("invalid timezone: %v", err)
+		}
+	}
+
+	if interval == "punchcard" {
+		commitTimes = true
+
+		if len(contribTypes) > 0 && !slices.Contains(contribTypes, skyline.ContributionTypeCommits) {
+			usageError("a punchcard only shows commits, so --types must include commits")
+		}
+	} else {
+		skylineInterval, err = skyline.ParseInterval(interval)
+		if err != nil {
+			usageError("%v, or punchcard", err)
+		}
 	}
 
-	if interval != "day" && interval != "week" {
-		panic(fmt.Errorf("invalid interval: %s; must be day or week", interval))
+	seriesOptions.FillGaps = fillGaps
+	seriesOptions.PadWeeks = padWeeks
+	seriesOptions.WeekStart, err = skyline.ParseWeekday(weekStart)
+	if err != nil {
+		usageError("%v", err)
 	}
 
 	if outputFile == "" && !saveContribs {
-		panic("output file is required unless you are using --save")
+		usageError("output file is required unless you are using --save")
 	}
 
 	parts := strings.Split(path.Base(outputFile), ".")
 	if len(parts) < 2 {
-		panic("output file must have an extension")
+		usageError("output file must have an extension")
 	}
 
 	outputFileType = skyline.OutputType(parts[len(parts)-1])
 	if outputFileType != skyline.OutputTypeSCAD && outputFileType != skyline.OutputTypeSTL {
-		panic("output file must be .scad or .stl")
+		usageError("output file must be .scad or .stl")
 	}
 }
 
 func main() {
+	if run := command(); run != nil {
+		run(os.Args[2:])
+		return
+	}
 
-	var err error
 	var contribs *skyline.Contributions
+	var existing *skyline.Contributions
+	var err error
 
-	if contribsFile != "" && !saveContribs {
-		contribs, err = skyline.NewContributionsFromFile(contribsFile)
-		if err != nil {
-			panic(err)
+	if updateContribs {
+		existing, err = skyline.NewContributionsFromFile(contribsFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fail(err)
+		}
+	}
+
+	// A saved team updates all its members and keeps its name, so a username
+	// from GITHUB_USERNAME isn't added to it
+	if existing != nil && existing.IsTeam() {
+		if !flag.CommandLine.Changed("username") && usernamesFile == "" {
+			usernames = nil
+		}
+
+		if !flag.CommandLine.Changed("team") {
+			team = ""
+		}
+	}
+
+	// Keep updated contributions in the timezone they were fetched in
+	if timezone == "" && existing != nil {
+		timezone = existing.Timezone
+	}
+
+	if timezone == "" {
+		timezone = skyline.LocalTimezone()
+	}
+
+	source, err := skyline.NewSource(sourceName, sourceConfig())
+	if err != nil {
+		usageError("%v", err)
+	}
+
+	if existing != nil {
+		updater, ok := source.(skyline.ContributionsUpdater)
+		if !ok {
+			usageError("the %s source does not support --update", sourceName)
 		}
+
+		fmt.Printf("Updating contributions in %s\n", contribsFile)
+		contribs, err = updater.UpdateContributions(existing, startYear, endYear)
 	} else {
-		fetcher := skyline.NewGitHubContributionsFetcher(username, token)
-		contribs, err = fetcher.FetchContributions(startYear, endYear)
+		contribs, err = source.FetchContributions(startYear, endYear)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+
+	if saveContribs {
+		err = contribs.SaveToFile(contribsFile)
 		if err != nil {
-			panic(err)
+			fail(err)
 		}
+	}
 
-		if saveContribs {
-			err = contribs.SaveToFile(contribsFile)
-			if err != nil {
-				panic(err)
-			}
+	// Re-slice a team to the requested members, after saving all of them
+	if contribs.IsTeam() && (flag.CommandLine.Changed("username") || usernamesFile != "") {
+		contribs, err = contribs.OnlyMembers(usernames...)
+		if err != nil {
+			fail(err)
+		}
+
+		if team != "" {
+			contribs.Username = team
+		}
+	}
+
+	if exportCSV != "" {
+		err = contribs.SaveToCSV(exportCSV)
+		if err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Contributions exported to %s\n", exportCSV)
+	}
+
+	if len(contribTypes) > 0 {
+		if privateMode == skyline.PrivateModeLayer && contribs.RestrictedContributions() > 0 {
+			fail(errors.New("restricted contributions have no type, so they can't be shown as a layer with --types"))
+		}
+
+		contribs, err = contribs.OnlyTypes(contribTypes...)
+		if err != nil {
+			fail(err)
 		}
+
+		fmt.Printf("Using only %s contributions\n", typesList)
 	}
 
 	if trimContribs {
@@ -135,18 +378,37 @@ func main() {
 	}
 
 	fmt.Printf("Total contributions: %d between %v and %v\n", contribs.TotalContributions, contribs.FirstDate, contribs.LastDate)
+	if len(contribs.RestrictedByYear) > 0 {
+		fmt.Printf("  Public: %d, restricted: %d\n", contribs.PublicContributions(), contribs.RestrictedContributions())
+	}
+
+	if privateMode == skyline.PrivateModeLayer && contribs.RestrictedContributions() > 0 && len(contribs.Restricted) == 0 {
+		fail(errors.New("contributions have no restricted counts by date; fetch them again with --breakdown to show them as a layer"))
+	}
 
 	fmt.Printf("Generating OpenSCAD ...\n")
 	sg := skyline.NewSkylineGenerator(*contribs, aspectRatioInts, maxBuildingHeight, buildingWidth, buildingLength, font)
-	sl := sg.Generate(interval)
+	sg.SeriesOptions = seriesOptions
+	var sl *skyline.Skyline
+	if interval == "punchcard" {
+		sl, err = sg.GeneratePunchcard(punchcardVertical)
+	} else {
+		sl, err = sg.Generate(skylineInterval)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+
 	sl.BaseAngle = baseAngle
 	sl.BaseHeight = baseHeight
 	sl.BaseMargin = baseMargin
+	sl.RestrictedLayer = privateMode == skyline.PrivateModeLayer
 
 	if outputFileType == skyline.OutputTypeSCAD {
 		dur, err := sl.ToOpenSCAD(outputFile)
 		if err != nil {
-			panic(err)
+			fail(err)
 		}
 
 		fmt.Printf("OpenSCAD file %s generated in %v\n", outputFile, dur)
@@ -156,9 +418,179 @@ func main() {
 
 		dur, err := sl.ToSTL(outputFile, openscadPath)
 		if err != nil {
-			panic(err)
+			fail(err)
 		}
 
 		fmt.Printf("STL file written to %s in %v\n", outputFile, dur)
 	}
 }
+
+func sourceConfig() skyline.SourceConfig {
+	config := skyline.SourceConfig{
+		Usernames:     usernames,
+		Team:          team,
+		Token:         token,
+		Path:          sourcePath,
+		URL:           apiURL,
+		Options:       sourceOptions,
+		GitHubOptions: fetcherOptions(),
+	}
+
+	// Don't send the GitHub credentials from the environment to other services
+	if sourceName != "github" && sourceName != "repo" {
+		if !flag.CommandLine.Changed("token") {
+			config.Token = ""
+		}
+
+		if !flag.CommandLine.Changed("api-url") {
+			config.URL = ""
+		}
+	}
+
+	if config.Options == nil {
+		config.Options = map[string]string{}
+	}
+
+	if config.Options["timezone"] == "" {
+		config.Options["timezone"] = timezone
+	}
+
+	if orgMembers != "" {
+		config.Options["org-members"] = orgMembers
+		config.Options["partial-file"] = contribsFile + ".partial"
+	}
+
+	return config
+}
+
+func fetcherOptions() []skyline.FetcherOption {
+	opts := []skyline.FetcherOption{
+		skyline.WithParallelism(parallelism),
+		skyline.WithTypeBreakdown(typeBreakdown),
+		skyline.WithCommitTimes(commitTimes),
+		skyline.WithOrganization(organization),
+	}
+
+	if caCertFile != "" {
+		pool, err := skyline.LoadCACertPool(caCertFile)
+		if err != nil {
+			usageError("invalid CA certificate file: %v", err)
+		}
+		opts = append(opts, skyline.WithRootCAs(pool))
+	}
+
+	if loc, err := time.LoadLocation(timezone); err == nil {
+		opts = append(opts, skyline.WithLocation(loc))
+	}
+
+	if tokenFile != "" {
+		opts = append(opts, skyline.WithTokenSource(skyline.TokenFile(tokenFile)))
+	}
+
+	if appID != "" {
+		key, err := os.ReadFile(appKeyFile)
+		if err != nil {
+			usageError("invalid GitHub App private key file: %v", err)
+		}
+
+		// Use the installation on the account the contributions are fetched for
+		account := orgMembers
+		if account == "" {
+			account = organization
+		}
+		if account == "" && len(usernames) > 0 {
+			account = usernames[0]
+		}
+
+		app, err := skyline.NewGitHubAppTokenSource(appID, key, appInstallation, account)
+		if err != nil {
+			usageError("%v", err)
+		}
+		opts = append(opts, skyline.WithTokenSource(app))
+	}
+
+	if useCache || offline {
+		cache, err := skyline.NewResponseCache(cacheDir, cacheTTL, offline)
+		if err != nil {
+			usageError("invalid cache directory: %v", err)
+		}
+		opts = append(opts, skyline.WithCache(cache))
+	}
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			usageError("invalid proxy URL: %s; %v", proxyURL, err)
+		}
+		opts = append(opts, skyline.WithProxyURL(u))
+	}
+
+	return opts
+}
+
+// splitUsernames splits a list of usernames separated by commas or newlines,
+// ignoring blank lines and # comments
+func splitUsernames(list string) []string {
+	usernames := []string{}
+	for _, line := range strings.Split(list, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "@"))
+			if name != "" {
+				usernames = append(usernames, name)
+			}
+		}
+	}
+
+	return usernames
+}
+
+// fail prints an error, with a hint on how to fix it if it is one of the
+// expected failures, and exits with the code for the failure
+func fail(err error) {
+	code, hint := exitError, ""
+
+	var badCredentials *skyline.BadCredentialsError
+	var scopes *skyline.InsufficientScopesError
+	var notFound *skyline.NotFoundError
+	var rateLimit *skyline.RateLimitError
+
+	switch {
+	case errors.As(err, &badCredentials):
+		code = exitBadCredentials
+		hint = "Check that the token is correct and hasn't expired or been revoked; GitHub tokens can be created at https://github.com/settings/tokens"
+	case errors.Is(err, skyline.ErrNoToken):
+		code = exitBadCredentials
+	case errors.As(err, &scopes):
+		code = exitScopes
+		hint = "Add the missing scope to the token at https://github.com/settings/tokens"
+	case errors.As(err, &notFound):
+		code = exitNotFound
+		hint = fmt.Sprintf("Check the spelling of the %s, and that the token has access to it", notFound.Kind)
+	case errors.As(err, &rateLimit):
+		code = exitRateLimited
+		hint = "Run the same command again once the rate limit resets; with --cache, the years already fetched are not fetched again"
+	case errors.Is(err, skyline.ErrNotCached):
+		hint = "Run it once without --offline to fill the cache"
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+
+	os.Exit(code)
+}
+
+// usageError prints an error about the command line options and exits
+func usageError(format string, args ...any) {
+	name := "github-skyline"
+	if commandName != "" {
+		name += " " + commandName
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	fmt.Fprintf(os.Stderr, "Run %s --help to see the options\n", name)
+
+	os.Exit(exitUsage)
+}
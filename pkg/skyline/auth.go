@@ -0,0 +1,489 @@
+package skyline
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoToken is returned when no GitHub token can be found
+var ErrNoToken = errors.New("no GitHub token found; use --token, GITHUB_TOKEN, --token-file, a GitHub App, `gh auth login` or ~/.netrc")
+
+// TokenSource provides the token for GitHub API requests, for credentials
+// that are looked up or minted when they are first used
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// credentialIdentity returns a stable identity of the credentials from a token
+// source, to key cached responses by.  It is the token itself, which is only
+// ever hashed, unless the source has an identity that outlives its tokens,
+// like a GitHub App installation.
+func credentialIdentity(tokens TokenSource) (string, error) {
+	if identified, ok := tokens.(interface{ identity() string }); ok {
+		return identified.identity(), nil
+	}
+
+	token, err := tokens.Token()
+	if err != nil {
+		return "", err
+	}
+
+	return "token " + token, nil
+}
+
+// tokenRoundTripper sets the Authorization header from a TokenSource
+type tokenRoundTripper struct {
+	source       TokenSource
+	roundTripper http.RoundTripper
+}
+
+func (trt *tokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := trt.source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return trt.roundTripper.RoundTrip(req)
+}
+
+// staticToken is a token given on the command line or in the environment
+type staticToken string
+
+func (st staticToken) Token() (string, error) {
+	return string(st), nil
+}
+
+// onceTokenSource looks up a token the first time it is needed
+type onceTokenSource struct {
+	lookup func() (string, error)
+	once   sync.Once
+	token  string
+	err    error
+}
+
+func (ots *onceTokenSource) Token() (string, error) {
+	ots.once.Do(func() {
+		ots.token, ots.err = ots.lookup()
+	})
+
+	return ots.token, ots.err
+}
+
+// TokenFile reads the token from a file, so it doesn't end up in the shell
+// history or the environment
+func TokenFile(file string) TokenSource {
+	return &onceTokenSource{lookup: func() (string, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading token file: %w", err)
+		}
+
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", file)
+		}
+
+		return token, nil
+	}}
+}
+
+// StoredToken finds the token for the GitHub instance at apiURL in the gh CLI
+// configuration or in ~/.netrc
+func StoredToken(apiURL string) TokenSource {
+	return &onceTokenSource{lookup: func() (string, error) {
+		host := githubHost(apiURL)
+
+		if token, err := ghConfigToken(host); err == nil && token != "" {
+			return token, nil
+		}
+
+		if token, err := netrcToken(host); err == nil && token != "" {
+			return token, nil
+		}
+
+		return "", ErrNoToken
+	}}
+}
+
+// githubHost returns the host users log in to for a GraphQL URL, like
+// github.com for https://api.github.com/graphql
+func githubHost(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return "github.com"
+	}
+
+	if u.Hostname() == "api.github.com" {
+		return "github.com"
+	}
+
+	return u.Hostname()
+}
+
+// restAPIURL returns the REST API base URL for a GraphQL URL
+func restAPIURL(apiURL string) string {
+	if strings.HasSuffix(apiURL, "/api/graphql") {
+		return strings.TrimSuffix(apiURL, "/graphql") + "/v3"
+	}
+
+	return strings.TrimSuffix(apiURL, "/graphql")
+}
+
+// ghConfigDir returns the directory of the gh CLI configuration
+func ghConfigDir() (string, error) {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh"), nil
+	}
+
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("AppData"); dir != "" {
+			return filepath.Join(dir, "GitHub CLI"), nil
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config", "gh"), nil
+}
+
+// ghConfigToken reads the oauth_token for a host from the gh CLI hosts.yml.
+// Only the simple mappings gh writes are understood, and tokens that gh keeps
+// in the system keyring are not found.
+func ghConfigToken(host string) (string, error) {
+	dir, err := ghConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	fh, err := os.Open(filepath.Join(dir, "hosts.yml"))
+	if err != nil {
+		return "", err
+	}
+
+	defer fh.Close()
+
+	inHost := false
+	hostIndent := -1
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		key, value, _ := strings.Cut(trimmed, ":")
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		if indent == 0 {
+			inHost = strings.EqualFold(strings.Trim(key, `"'`), host)
+			hostIndent = -1
+			continue
+		}
+
+		if !inHost {
+			continue
+		}
+
+		// Only read the keys directly under the host, not those of each user
+		if hostIndent == -1 {
+			hostIndent = indent
+		}
+
+		if indent == hostIndent && key == "oauth_token" && value != "" {
+			return value, nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// netrcToken reads the password for a host, or the GitHub API host, from the
+// file in the NETRC environment variable or ~/.netrc
+func netrcToken(host string) (string, error) {
+	file := os.Getenv("NETRC")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+
+		file = filepath.Join(home, name)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	hosts := map[string]bool{host: true, "api." + host: true}
+
+	fields := strings.Fields(string(data))
+	matched := false
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if i+1 < len(fields) {
+				i++
+				matched = hosts[fields[i]]
+			}
+		case "default":
+			matched = true
+		case "login", "account":
+			i++
+		case "password":
+			if i+1 < len(fields) {
+				i++
+				if matched {
+					return fields[i], nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// GitHubAppTokenSource mints installation tokens for a GitHub App, so
+// automation can run without a personal token.  A token is minted on first
+// use and again shortly before it expires.
+type GitHubAppTokenSource struct {
+	// AppID is the ID of the GitHub App
+	AppID string
+	// InstallationID is the installation of the app to get a token for.  If it
+	// is 0, the installation on Account is used, or the only installation.
+	InstallationID int64
+	// Account is the user or organization the app is installed on
+	Account string
+
+	privateKey *rsa.PrivateKey
+	apiURL     string
+	client     *http.Client
+
+	mu           sync.Mutex
+	installation int64
+	token        string
+	expiresAt    time.Time
+}
+
+// NewGitHubAppTokenSource creates a token source for a GitHub App from its ID
+// and PEM encoded private key
+func NewGitHubAppTokenSource(appID string, privateKeyPEM []byte, installationID int64, account string) (*GitHubAppTokenSource, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: no PEM data found")
+	}
+
+	var key *rsa.PrivateKey
+	if pkcs1, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = pkcs1
+	} else {
+		pkcs8, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub App private key: %w", err)
+		}
+
+		rsaKey, ok := pkcs8.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("invalid GitHub App private key: not an RSA key")
+		}
+		key = rsaKey
+	}
+
+	return &GitHubAppTokenSource{
+		AppID:          appID,
+		InstallationID: installationID,
+		Account:        account,
+		privateKey:     key,
+	}, nil
+}
+
+// configure sets the API and transport to mint tokens with, unless they are
+// already set
+func (gats *GitHubAppTokenSource) configure(apiURL string, roundTripper http.RoundTripper) {
+	gats.mu.Lock()
+	defer gats.mu.Unlock()
+
+	gats.setup(apiURL, roundTripper)
+}
+
+func (gats *GitHubAppTokenSource) setup(apiURL string, roundTripper http.RoundTripper) {
+	if gats.apiURL == "" {
+		gats.apiURL = restAPIURL(apiURL)
+	}
+
+	if gats.client == nil {
+		gats.client = newClientWithHeaders(map[string]string{
+			"Accept":     "application/vnd.github+json",
+			"User-Agent": "github-skyline",
+		}, roundTripper)
+	}
+}
+
+// identity is the app and the installation or account it was configured with,
+// since its tokens change every hour
+func (gats *GitHubAppTokenSource) identity() string {
+	return fmt.Sprintf("app %s installation %d account %s", gats.AppID, gats.InstallationID, strings.ToLower(gats.Account))
+}
+
+func (gats *GitHubAppTokenSource) Token() (string, error) {
+	gats.mu.Lock()
+	defer gats.mu.Unlock()
+
+	if gats.token != "" && time.Until(gats.expiresAt) > time.Minute {
+		return gats.token, nil
+	}
+
+	gats.setup(githubAPIURL, http.DefaultTransport)
+
+	jwt, err := gats.jwt()
+	if err != nil {
+		return "", err
+	}
+
+	if gats.installation == 0 {
+		gats.installation = gats.InstallationID
+	}
+
+	if gats.installation == 0 {
+		gats.installation, err = gats.findInstallation(jwt)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", gats.installation)
+	if err := gats.request(http.MethodPost, path, jwt, &resp); err != nil {
+		return "", fmt.Errorf("creating GitHub App installation token: %w", err)
+	}
+
+	gats.token = resp.Token
+	gats.expiresAt = resp.ExpiresAt
+
+	return gats.token, nil
+}
+
+// jwt creates the JSON Web Token that authenticates as the app itself
+func (gats *GitHubAppTokenSource) jwt() (string, error) {
+	now := time.Now()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		// Allow for clock drift, GitHub rejects tokens issued in the future
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": gats.AppID,
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, gats.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing GitHub App JWT: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// findInstallation returns the ID of the installation on the account, or of
+// the only installation of the app
+func (gats *GitHubAppTokenSource) findInstallation(jwt string) (int64, error) {
+	var installations []struct {
+		ID      int64 `json:"id"`
+		Account struct {
+			Login string `json:"login"`
+		} `json:"account"`
+	}
+
+	if err := gats.request(http.MethodGet, "/app/installations?per_page=100", jwt, &installations); err != nil {
+		return 0, fmt.Errorf("listing GitHub App installations: %w", err)
+	}
+
+	accounts := []string{}
+	for _, installation := range installations {
+		if gats.Account != "" && strings.EqualFold(installation.Account.Login, gats.Account) {
+			return installation.ID, nil
+		}
+
+		accounts = append(accounts, installation.Account.Login)
+	}
+
+	if gats.Account == "" && len(installations) == 1 {
+		return installations[0].ID, nil
+	}
+
+	if len(installations) == 0 {
+		return 0, fmt.Errorf("the GitHub App %s is not installed on any account", gats.AppID)
+	}
+
+	return 0, fmt.Errorf("no GitHub App installation found for %q; the app is installed on %v", gats.Account, accounts)
+}
+
+func (gats *GitHubAppTokenSource) request(method, path, jwt string, v any) error {
+	req, err := http.NewRequest(method, gats.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := gats.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s %s: %v; body: %q", method, path, resp.Status, bytes.TrimSpace(body))
+	}
+
+	return json.Unmarshal(body, v)
+}
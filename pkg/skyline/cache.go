@@ -0,0 +1,282 @@
+package skyline
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// DefaultCacheTTL is how long cached responses about the current year are used
+const DefaultCacheTTL = time.Hour
+
+// ErrNotCached is returned for requests that are not in the cache when offline
+var ErrNotCached = errors.New("response is not in the cache")
+
+// cacheDatePattern matches the dates in GraphQL variables, like the start of
+// the year a query is for
+var cacheDatePattern = regexp.MustCompile(`"(\d{4})-\d{2}-\d{2}T[^"]*"`)
+
+// ResponseCache stores API responses on disk, keyed by the request, so fetching
+// the same data again doesn't make any requests.  Responses about past years
+// never change and are kept forever.  Other responses are used for the TTL,
+// and then revalidated with a conditional request if the server sent an ETag
+// or Last-Modified header.
+type ResponseCache struct {
+	// Dir is the directory the responses are stored in
+	Dir string
+	// TTL is how long responses that aren't about a past year are used
+	TTL time.Duration
+	// Offline only replays cached responses, however old, and fails any
+	// request that is not in the cache
+	Offline bool
+
+	now func() time.Time
+}
+
+type cachedResponse struct {
+	URL          string      `json:"url"`
+	StoredAt     time.Time   `json:"stored_at"`
+	Immutable    bool        `json:"immutable"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+}
+
+// NewResponseCache creates a cache in dir, or in the user's cache directory if
+// dir is empty
+func NewResponseCache(dir string, ttl time.Duration, offline bool) (*ResponseCache, error) {
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("no cache directory: %w", err)
+		}
+
+		dir = filepath.Join(userDir, "github-skyline")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &ResponseCache{
+		Dir:     dir,
+		TTL:     ttl,
+		Offline: offline,
+		now:     time.Now,
+	}, nil
+}
+
+// wrap returns a RoundTripper that answers requests made with the credentials
+// from the cache before passing them on to roundTripper.  A nil cache returns
+// roundTripper as is.
+func (rc *ResponseCache) wrap(credentials TokenSource, roundTripper http.RoundTripper) http.RoundTripper {
+	if rc == nil {
+		return roundTripper
+	}
+
+	return &cacheRoundTripper{
+		cache:        rc,
+		credentials:  credentials,
+		roundTripper: roundTripper,
+	}
+}
+
+type cacheRoundTripper struct {
+	cache        *ResponseCache
+	credentials  TokenSource
+	roundTripper http.RoundTripper
+}
+
+func (crt *cacheRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	identity, err := credentialIdentity(crt.credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	key := crt.cache.key(req, identity, body)
+	cached := crt.cache.load(key)
+
+	if cached != nil && (crt.cache.Offline || cached.Immutable || crt.cache.now().Sub(cached.StoredAt) < crt.cache.TTL) {
+		return cached.response(req), nil
+	}
+
+	if crt.cache.Offline {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotCached, req.Method, req.URL)
+	}
+
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := crt.roundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+
+		cached.StoredAt = crt.cache.now()
+		crt.cache.store(key, cached)
+
+		return cached.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if !hasGraphQLErrors(respBody) {
+		crt.cache.store(key, &cachedResponse{
+			URL:          req.URL.String(),
+			StoredAt:     crt.cache.now(),
+			Immutable:    crt.cache.immutable(body),
+			StatusCode:   resp.StatusCode,
+			Header:       resp.Header,
+			Body:         respBody,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		})
+	}
+
+	return resp, nil
+}
+
+// key identifies a request by its method, URL, credentials and body, which for
+// GraphQL is the query and variables.  Responses can include private
+// contributions, so they must never be replayed for other credentials.
+func (rc *ResponseCache) key(req *http.Request, identity string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n%s\n", req.Method, req.URL, identity)
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// immutable reports whether a request is only about past years, which is the
+// case if all the dates in its variables are before the current year
+func (rc *ResponseCache) immutable(body []byte) bool {
+	matches := cacheDatePattern.FindAllSubmatch(body, -1)
+	if len(matches) == 0 {
+		return false
+	}
+
+	thisYear := fmt.Sprint(rc.now().Year())
+	for _, match := range matches {
+		if string(match[1]) >= thisYear {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (rc *ResponseCache) path(key string) string {
+	return filepath.Join(rc.Dir, key+".json")
+}
+
+// load returns the cached response for a key, or nil if there is none
+func (rc *ResponseCache) load(key string) *cachedResponse {
+	data, err := os.ReadFile(rc.path(key))
+	if err != nil {
+		return nil
+	}
+
+	cached := &cachedResponse{}
+	if err := json.Unmarshal(data, cached); err != nil {
+		return nil
+	}
+
+	return cached
+}
+
+// store saves a response, ignoring errors since the cache is only an optimization
+func (rc *ResponseCache) store(key string, cached *cachedResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+
+	// Write to a temporary file first so concurrent readers never see part of it
+	tmp, err := os.CreateTemp(rc.Dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+
+	_, err = tmp.Write(data)
+	tmp.Close()
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), rc.path(key)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+func (cr *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", cr.StatusCode, http.StatusText(cr.StatusCode)),
+		StatusCode:    cr.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cr.Header,
+		Body:          io.NopCloser(bytes.NewReader(cr.Body)),
+		ContentLength: int64(len(cr.Body)),
+		Request:       req,
+	}
+}
+
+// hasGraphQLErrors reports whether a response body has GraphQL errors, which
+// are often temporary and shouldn't be cached
+func hasGraphQLErrors(body []byte) bool {
+	var resp struct {
+		Errors json.RawMessage `json:"errors"`
+	}
+
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+
+	return len(resp.Errors) > 0 && string(resp.Errors) != "null" && string(resp.Errors) != "[]"
+}
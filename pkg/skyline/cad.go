@@ -30,14 +30,18 @@ type SkylineGenerator struct {
 	buildingWidth  float64
 	buildingLength float64
 	font           string
+	// SeriesOptions control the week start and gap filling of the buildings,
+	// and the order of the days in a punchcard
+	SeriesOptions SeriesOptions
 }
 
 type Building struct {
 	*BoundingBox
-	Col   int
-	Row   int
-	Count int
-	Date  string
+	Col        int
+	Row        int
+	Count      int
+	Restricted int
+	Date       string
 }
 
 type BoundingBox struct {
@@ -64,6 +68,9 @@ type Skyline struct {
 	Font              string
 	TextLeft          string
 	TextRight         string
+	// RestrictedLayer shows the restricted contributions in each building as
+	// a separate layer in another color
+	RestrictedLayer bool
 }
 
 // NewSkylineGenerator creates a new SkylineGenerator
@@ -80,13 +87,90 @@ func NewSkylineGenerator(Contributions Contributions, aspectRatio [2]int, maxHei
 		buildingWidth:  buildingWidth,
 		buildingLength: buildingLength,
 		font:           font,
+		SeriesOptions:  DefaultSeriesOptions,
 	}
 
 	return sg
 }
 
-func (sg *SkylineGenerator) Generate(interval string) *Skyline {
-	matrix, contribs := sg.computeMatrix(interval)
+// Generate creates a skyline with a building for each interval of the
+// contributions
+func (sg *SkylineGenerator) Generate(interval Interval) (*Skyline, error) {
+	contribs, err := sg.contributions.Series(interval, sg.SeriesOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(contribs) == 0 {
+		return nil, fmt.Errorf("no contributions to build a skyline from")
+	}
+
+	matrix := sg.computeMatrix(contribs)
+
+	return sg.newSkyline(matrix, contribs.Max()), nil
+}
+
+// GeneratePunchcard creates a skyline of the commits by hour of day and day of
+// week, with a column per hour and a row per weekday, or a column per weekday
+// and a row per hour if vertical is set
+func (sg *SkylineGenerator) GeneratePunchcard(vertical bool) (*Skyline, error) {
+	pc, err := sg.contributions.Punchcard()
+	if err != nil {
+		return nil, err
+	}
+
+	cols, rows := 24, 7
+	if vertical {
+		cols, rows = 7, 24
+	}
+
+	fmt.Printf("Skyline details:\n")
+	fmt.Printf("  Buildings: %d (%v x %v punchcard)\n", cols*rows, cols, rows)
+	fmt.Printf("  Dimensions: %0.1fmm x %0.1fmm\n", float64(cols)*sg.buildingWidth, float64(rows)*sg.buildingLength)
+
+	maxCommits := pc.Max()
+
+	matrix := make([][]*Building, cols)
+	for col := range matrix {
+		matrix[col] = make([]*Building, rows)
+		for row := range matrix[col] {
+			weekday, hour := row, col
+			if vertical {
+				weekday, hour = col, row
+			}
+
+			weekday = (weekday + int(sg.SeriesOptions.WeekStart)) % 7
+
+			count := pc[weekday][hour]
+
+			height := 0.0
+			if maxCommits > 0 {
+				height = float64(count) / float64(maxCommits) * sg.maxHeight
+			}
+
+			matrix[col][row] = &Building{
+				BoundingBox: &BoundingBox{
+					MinX:   float64(col) * sg.buildingWidth,
+					MinY:   float64(row) * sg.buildingLength,
+					MaxX:   float64(col+1) * sg.buildingWidth,
+					MaxY:   float64(row+1) * sg.buildingLength,
+					Length: sg.buildingLength,
+					Width:  sg.buildingWidth,
+					Height: height,
+				},
+				Col:   col,
+				Row:   row,
+				Count: count,
+				Date:  fmt.Sprintf("%s %02d:00", time.Weekday(weekday).String()[:3], hour),
+			}
+		}
+	}
+
+	return sg.newSkyline(matrix, maxCommits), nil
+}
+
+// newSkyline creates a skyline from a matrix of buildings
+func (sg *SkylineGenerator) newSkyline(matrix [][]*Building, maxContributions int) *Skyline {
 	buildings := []Building{}
 	for _, col := range matrix {
 		for _, b := range col {
@@ -102,7 +186,7 @@ func (sg *SkylineGenerator) Generate(interval string) *Skyline {
 		BuildingWidth:     sg.buildingWidth,
 		BuildingLength:    sg.buildingLength,
 		MaxBuildingHeight: sg.maxHeight,
-		MaxContributions:  contribs.Max(),
+		MaxContributions:  maxContributions,
 		Bounds: BoundingBox{
 			MinX:   0,
 			MinY:   0,
@@ -116,27 +200,16 @@ func (sg *SkylineGenerator) Generate(interval string) *Skyline {
 		BaseHeight: defaultBaseHeight,
 		BaseAngle:  defaultBaseAngle,
 		Font:       sg.font,
-		TextLeft:   "@" + sg.contributions.Username,
+		TextLeft:   sg.contributions.Label(),
 		TextRight:  sg.contributions.YearRangeText(),
 	}
 
 	return skyline
 }
 
-func (sg *SkylineGenerator) computeMatrix(interval string) ([][]*Building, StatsCollection) {
+func (sg *SkylineGenerator) computeMatrix(contribs StatsCollection) [][]*Building {
 	// Calculate the number of rows and columns based on the aspect ratio
 	// of the skyline and the number of contributions
-	var contribs StatsCollection
-
-	switch interval {
-	case "day":
-		contribs = sg.contributions.PerDay()
-	case "week":
-		contribs = sg.contributions.PerWeek()
-	default:
-		panic(fmt.Errorf("invalid interval: %s; must be day or week", interval))
-	}
-
 	numBuildings := float64(len(contribs))
 
 	cols := int(math.Ceil(math.Sqrt(numBuildings * sg.aspectRatio)))
@@ -172,6 +245,13 @@ func (sg *SkylineGenerator) computeMatrix(interval string) ([][]*Building, Stats
 			}
 
 			contrib := contribs[i]
+
+			// Filled gaps can leave a skyline without any contributions
+			height := 0.0
+			if maxContributions > 0 {
+				height = float64(contrib.Count) / float64(maxContributions) * sg.maxHeight
+			}
+
 			building := &Building{
 				BoundingBox: &BoundingBox{
 					MinX:   float64(col) * sg.buildingWidth,
@@ -180,12 +260,13 @@ func (sg *SkylineGenerator) computeMatrix(interval string) ([][]*Building, Stats
 					MaxY:   float64(row+1) * sg.buildingLength,
 					Length: sg.buildingLength,
 					Width:  sg.buildingWidth,
-					Height: float64(contrib.Count) / float64(maxContributions) * sg.maxHeight,
+					Height: height,
 				},
-				Col:   col,
-				Row:   row,
-				Count: contrib.Count,
-				Date:  contrib.Date,
+				Col:        col,
+				Row:        row,
+				Count:      contrib.Count,
+				Restricted: contrib.Restricted,
+				Date:       contrib.Date,
 			}
 
 			matrix[col][row] = building
@@ -193,7 +274,7 @@ func (sg *SkylineGenerator) computeMatrix(interval string) ([][]*Building, Stats
 		}
 	}
 
-	return matrix, contribs
+	return matrix
 }
 
 var (
@@ -254,6 +335,17 @@ var (
         ])
         cube([buildingWidth, buildingLength, height]);
 }`
+
+	restrictedModule = `module restricted(row, col, contributions, restricted) {
+    bottom = (contributions - restricted) / maxContributions * maxBuildingHeight;
+    height = restricted / maxContributions * maxBuildingHeight;
+    color(restrictedColor)
+        translate([
+            (col * buildingWidth)+baseMargin+baseOffset,
+            (row * buildingLength)+baseMargin+baseOffset, baseHeight + bottom
+        ])
+        cube([buildingWidth, buildingLength, height]);
+}`
 )
 
 func (sl *Skyline) ToOpenSCAD(filename string) (time.Duration, error) {
@@ -287,6 +379,9 @@ func (sl *Skyline) ToOpenSCAD(filename string) (time.Duration, error) {
 	fmt.Fprintf(out, "buildingLength = %f;\n", sl.BuildingLength)
 	fmt.Fprintf(out, "maxBuildingHeight = %f;\n", sl.MaxBuildingHeight)
 	fmt.Fprintf(out, `buildingColor = "red";`+"\n")
+	if sl.RestrictedLayer {
+		fmt.Fprintf(out, `restrictedColor = "gray";`+"\n")
+	}
 
 	fmt.Fprintf(out, "\n// GitHub Parameters\n")
 	fmt.Fprintf(out, "maxContributions = %d;\n", sl.MaxContributions)
@@ -295,6 +390,9 @@ func (sl *Skyline) ToOpenSCAD(filename string) (time.Duration, error) {
 
 	fmt.Fprintf(out, "%v\n\n", baseModule)
 	fmt.Fprintf(out, "%v\n\n", buildingModule)
+	if sl.RestrictedLayer {
+		fmt.Fprintf(out, "%v\n\n", restrictedModule)
+	}
 
 	fmt.Fprintf(out, "union() {\n")
 	fmt.Fprintf(out, "  base();\n")
@@ -305,6 +403,17 @@ func (sl *Skyline) ToOpenSCAD(filename string) (time.Duration, error) {
 			continue
 		}
 
+		if sl.RestrictedLayer && b.Restricted > 0 {
+			if b.Count > b.Restricted {
+				fmt.Fprintf(out, "  building(%d, %d, %d); // %v\n",
+					b.Row, b.Col, b.Count-b.Restricted, b.Date)
+			}
+
+			fmt.Fprintf(out, "  restricted(%d, %d, %d, %d); // %v\n",
+				b.Row, b.Col, b.Count, b.Restricted, b.Date)
+			continue
+		}
+
 		fmt.Fprintf(out, "  building(%d, %d, %d); // %v\n",
 			b.Row, b.Col, b.Count, b.Date)
 	}
@@ -0,0 +1,496 @@
+package skyline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Stats struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+	// Restricted is the part of Count that is restricted contributions
+	Restricted int `json:"restricted,omitempty"`
+}
+
+type StatsCollection []Stats
+
+func (sc StatsCollection) Max() int {
+	max := 0
+	for _, s := range sc {
+		if s.Count > max {
+			max = s.Count
+		}
+	}
+
+	return max
+}
+
+// ContributionType is a kind of contribution counted in the GitHub calendar
+type ContributionType string
+
+const (
+	ContributionTypeCommits      = ContributionType("commits")
+	ContributionTypeIssues       = ContributionType("issues")
+	ContributionTypePullRequests = ContributionType("pull_requests")
+	ContributionTypeReviews      = ContributionType("reviews")
+	ContributionTypeRepositories = ContributionType("repositories")
+)
+
+var ContributionTypes = []ContributionType{
+	ContributionTypeCommits,
+	ContributionTypeIssues,
+	ContributionTypePullRequests,
+	ContributionTypeReviews,
+	ContributionTypeRepositories,
+}
+
+// ParseContributionTypes parses a comma separated list of contribution types
+func ParseContributionTypes(list string) ([]ContributionType, error) {
+	types := []ContributionType{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if !slices.Contains(ContributionTypes, ContributionType(name)) {
+			return nil, fmt.Errorf("invalid contribution type: %s; must be one of %v", name, ContributionTypes)
+		}
+
+		types = append(types, ContributionType(name))
+	}
+
+	return types, nil
+}
+
+type Contributions struct {
+	SchemaVersion      int                                 `json:"schema_version,omitempty"`
+	Username           string                              `json:"username"`
+	Organization       string                              `json:"organization,omitempty"`
+	Repository         string                              `json:"repository,omitempty"`
+	Timezone           string                              `json:"timezone,omitempty"`
+	TotalContributions int                                 `json:"total_contributions"`
+	FirstDate          string                              `json:"first_date"`
+	LastDate           string                              `json:"last_date"`
+	ByDate             map[string]int                      `json:"by_date"`
+	ByType             map[ContributionType]map[string]int `json:"by_type,omitempty"`
+	ByHour             map[string][24]int                  `json:"by_hour,omitempty"`
+	RestrictedByYear   map[int]int                         `json:"restricted_by_year,omitempty"`
+	Restricted         map[string]int                      `json:"restricted,omitempty"`
+	Members            map[string]*Contributions           `json:"members,omitempty"`
+}
+
+// OnlyTypes returns a copy of the contributions where the count for each date
+// is the sum of the given contribution types, for the team members too.  The
+// commit times are kept if commits are one of the types.  Restricted
+// contributions are left out, since their types are unknown.  This requires
+// the per-type breakdown, which is only fetched on request.
+func (c *Contributions) OnlyTypes(types ...ContributionType) (*Contributions, error) {
+	if len(c.ByType) == 0 {
+		return nil, fmt.Errorf("contributions have no per-type breakdown; fetch them again with the breakdown enabled")
+	}
+
+	if years := c.yearsWithoutBreakdown(); len(years) > 0 {
+		fmt.Printf("No per-type breakdown for %s in %v, so those years are left empty; update them with the breakdown enabled\n", c.Label(), years)
+	}
+
+	filtered := &Contributions{
+		Username:     c.Username,
+		Organization: c.Organization,
+		Repository:   c.Repository,
+		Timezone:     c.Timezone,
+		ByDate:       make(map[string]int, len(c.ByDate)),
+		ByType:       make(map[ContributionType]map[string]int, len(types)),
+	}
+
+	// Keep every date from the calendar so the skyline covers the same range
+	for date := range c.ByDate {
+		filtered.ByDate[date] = 0
+	}
+
+	for _, contribType := range types {
+		filtered.ByType[contribType] = make(map[string]int)
+		for date, count := range c.ByType[contribType] {
+			filtered.ByType[contribType][date] = count
+			filtered.ByDate[date] += count
+		}
+	}
+
+	if slices.Contains(types, ContributionTypeCommits) && len(c.ByHour) > 0 {
+		filtered.ByHour = make(map[string][24]int, len(c.ByHour))
+		for date, hours := range c.ByHour {
+			filtered.ByHour[date] = hours
+		}
+	}
+
+	for username, member := range c.Members {
+		filteredMember, err := member.OnlyTypes(types...)
+		if err != nil {
+			return nil, fmt.Errorf("member %s: %w", username, err)
+		}
+
+		if filtered.Members == nil {
+			filtered.Members = make(map[string]*Contributions, len(c.Members))
+		}
+
+		filtered.Members[username] = filteredMember
+	}
+
+	filtered.Recompute()
+
+	return filtered, nil
+}
+
+// yearsWithoutBreakdown returns the years that have public contributions but
+// nothing in the per-type breakdown, like years that were fetched before the
+// breakdown was enabled
+func (c *Contributions) yearsWithoutBreakdown() []int {
+	public := map[int]int{}
+	for date, count := range c.ByDate {
+		if t, err := time.Parse("2006-01-02", date); err == nil {
+			public[t.Year()] += count
+		}
+	}
+
+	for year, count := range c.RestrictedByYear {
+		public[year] -= count
+	}
+
+	typed := map[int]bool{}
+	for _, byDate := range c.ByType {
+		for date, count := range byDate {
+			if t, err := time.Parse("2006-01-02", date); err == nil && count > 0 {
+				typed[t.Year()] = true
+			}
+		}
+	}
+
+	years := []int{}
+	for _, year := range sortedKeys(public) {
+		if public[year] > 0 && !typed[year] {
+			years = append(years, year)
+		}
+	}
+
+	return years
+}
+
+// TrimStartYear trims the contributions to the first year with at least one
+// contribution, and returns true if that moved the first date
+func (c *Contributions) TrimStartYear() bool {
+	firstContributionYear := 0
+	for date, numContribs := range c.ByDate {
+
+		if numContribs == 0 {
+			continue
+		}
+
+		year, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			panic(err)
+		}
+
+		if firstContributionYear == 0 || year.Year() < firstContributionYear {
+			firstContributionYear = year.Year()
+		}
+	}
+
+	fmt.Printf("First contribution year: %d\n", firstContributionYear)
+
+	if firstContributionYear == 0 {
+		return false
+	}
+
+	for date := range c.ByDate {
+		year, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			panic(err)
+		}
+
+		if year.Year() < firstContributionYear {
+			delete(c.ByDate, date)
+
+			for _, byDate := range c.ByType {
+				delete(byDate, date)
+			}
+
+			delete(c.ByHour, date)
+			delete(c.Restricted, date)
+		}
+	}
+
+	for year := range c.RestrictedByYear {
+		if year < firstContributionYear {
+			delete(c.RestrictedByYear, year)
+		}
+	}
+
+	// The first date is the first one with data, which is only January 1st
+	// for sources like the GitHub calendar that have every day of the year
+	firstDate := c.FirstDate
+	c.Recompute()
+
+	return c.FirstDate != firstDate
+}
+
+func (c *Contributions) YearRangeText() string {
+	startYear := c.FirstDate[:4]
+	endYear := c.LastDate[:4]
+
+	if startYear == endYear {
+		return startYear
+	}
+
+	return fmt.Sprintf("%s-%s", startYear, endYear)
+}
+
+// PerDay returns the count of each date in ByDate
+func (c *Contributions) PerDay() StatsCollection {
+	return c.aggregate(dayBucket)
+}
+
+// PerWeek sums the contributions by ISO week, like 2024-05
+func (c *Contributions) PerWeek() StatsCollection {
+	return c.aggregate(weekBucket(time.Monday))
+}
+
+// Recompute updates TotalContributions, FirstDate and LastDate from ByDate
+func (c *Contributions) Recompute() {
+	c.TotalContributions = 0
+	c.FirstDate = ""
+	c.LastDate = ""
+
+	for date, count := range c.ByDate {
+		c.TotalContributions += count
+
+		if c.FirstDate == "" || date < c.FirstDate {
+			c.FirstDate = date
+		}
+
+		if c.LastDate == "" || date > c.LastDate {
+			c.LastDate = date
+		}
+	}
+}
+
+// Merge copies the counts from other into c, replacing everything c has for
+// the dates in other, and recomputes the totals
+func (c *Contributions) Merge(other *Contributions) {
+	if c.ByDate == nil {
+		c.ByDate = make(map[string]int)
+	}
+
+	for date, count := range other.ByDate {
+		c.ByDate[date] = count
+
+		// A date's types, hours and restricted estimate are replaced with the
+		// ones in other, or cleared if other doesn't have them
+		for _, byDate := range c.ByType {
+			delete(byDate, date)
+		}
+
+		delete(c.ByHour, date)
+		delete(c.Restricted, date)
+	}
+
+	for contribType, byDate := range other.ByType {
+		if c.ByType == nil {
+			c.ByType = make(map[ContributionType]map[string]int)
+		}
+
+		if c.ByType[contribType] == nil {
+			c.ByType[contribType] = make(map[string]int)
+		}
+
+		for date, count := range byDate {
+			c.ByType[contribType][date] = count
+		}
+	}
+
+	for date, hours := range other.ByHour {
+		if c.ByHour == nil {
+			c.ByHour = make(map[string][24]int)
+		}
+
+		c.ByHour[date] = hours
+	}
+
+	for year, count := range other.RestrictedByYear {
+		if c.RestrictedByYear == nil {
+			c.RestrictedByYear = make(map[int]int)
+		}
+
+		c.RestrictedByYear[year] = count
+
+		// The estimate for each day is replaced along with the year
+		prefix := fmt.Sprintf("%d-", year)
+		for date := range c.Restricted {
+			if strings.HasPrefix(date, prefix) {
+				delete(c.Restricted, date)
+			}
+		}
+	}
+
+	for date, count := range other.Restricted {
+		if c.Restricted == nil {
+			c.Restricted = make(map[string]int)
+		}
+
+		c.Restricted[date] = count
+	}
+
+	c.Recompute()
+}
+
+// OnlyYears returns a copy of the contributions between startYear and endYear
+// (inclusive).  A year of 0 leaves that end of the range open.
+func (c *Contributions) OnlyYears(startYear, endYear int) *Contributions {
+	inRange := func(date string) bool {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return false
+		}
+
+		return (startYear == 0 || t.Year() >= startYear) && (endYear == 0 || t.Year() <= endYear)
+	}
+
+	filtered := &Contributions{
+		Username:     c.Username,
+		Organization: c.Organization,
+		Repository:   c.Repository,
+		Timezone:     c.Timezone,
+		ByDate:       make(map[string]int),
+	}
+
+	for date, count := range c.ByDate {
+		if inRange(date) {
+			filtered.ByDate[date] = count
+		}
+	}
+
+	for contribType, byDate := range c.ByType {
+		if filtered.ByType == nil {
+			filtered.ByType = make(map[ContributionType]map[string]int)
+		}
+
+		filtered.ByType[contribType] = make(map[string]int)
+		for date, count := range byDate {
+			if inRange(date) {
+				filtered.ByType[contribType][date] = count
+			}
+		}
+	}
+
+	for date, hours := range c.ByHour {
+		if inRange(date) {
+			if filtered.ByHour == nil {
+				filtered.ByHour = make(map[string][24]int)
+			}
+
+			filtered.ByHour[date] = hours
+		}
+	}
+
+	for year, count := range c.RestrictedByYear {
+		if (startYear == 0 || year >= startYear) && (endYear == 0 || year <= endYear) {
+			if filtered.RestrictedByYear == nil {
+				filtered.RestrictedByYear = make(map[int]int)
+			}
+
+			filtered.RestrictedByYear[year] = count
+		}
+	}
+
+	for date, count := range c.Restricted {
+		if inRange(date) {
+			if filtered.Restricted == nil {
+				filtered.Restricted = make(map[string]int)
+			}
+
+			filtered.Restricted[date] = count
+		}
+	}
+
+	for username, member := range c.Members {
+		if filtered.Members == nil {
+			filtered.Members = make(map[string]*Contributions)
+		}
+
+		filtered.Members[username] = member.OnlyYears(startYear, endYear)
+	}
+
+	filtered.Recompute()
+
+	return filtered
+}
+
+// SaveToFile saves the contributions as JSON, in the current schema version
+func (c *Contributions) SaveToFile(file string) error {
+	fh, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	defer fh.Close()
+
+	return c.WriteJSON(fh)
+}
+
+// WriteJSON writes the contributions as JSON, in the current schema version
+func (c *Contributions) WriteJSON(w io.Writer) error {
+	c.SchemaVersion = SchemaVersion
+
+	// Indent so problems in a hand-edited file can be reported by line
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(c)
+}
+
+// NewContributionsFromFile loads contributions saved with SaveToFile.  Files
+// from older versions are migrated to the current schema version, and the
+// contributions are validated, returning a *ValidationError with every
+// problem found and its line in the file.
+func NewContributionsFromFile(file string) (*Contributions, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeContributions(file, data)
+}
+
+func init() {
+	RegisterSource("file", newFileSource)
+}
+
+// fileSource loads contributions saved with SaveToFile
+type fileSource struct {
+	file string
+}
+
+func newFileSource(config SourceConfig) (ContributionsSource, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("the file source requires the path of a contributions file")
+	}
+
+	return &fileSource{file: config.Path}, nil
+}
+
+func (fs *fileSource) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	contribs, err := NewContributionsFromFile(fs.file)
+	if err != nil {
+		return nil, err
+	}
+
+	if startYear == 0 && endYear == 0 {
+		return contribs, nil
+	}
+
+	return contribs.OnlyYears(startYear, endYear), nil
+}
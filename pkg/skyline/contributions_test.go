@@ -0,0 +1,82 @@
+package skyline
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestTrimStartYear(t *testing.T) {
+	tests := []struct {
+		name          string
+		byDate        map[string]int
+		wantTrimmed   bool
+		wantFirstDate string
+		wantDates     []string
+	}{
+		{
+			name: "calendar with empty years",
+			byDate: map[string]int{
+				"2022-01-01": 0,
+				"2022-12-31": 0,
+				"2023-01-01": 0,
+				"2023-06-15": 3,
+			},
+			wantTrimmed:   true,
+			wantFirstDate: "2023-01-01",
+			wantDates:     []string{"2023-01-01", "2023-06-15"},
+		},
+		{
+			name: "short history",
+			byDate: map[string]int{
+				"2025-10-17": 2,
+				"2025-11-01": 1,
+			},
+			wantTrimmed:   false,
+			wantFirstDate: "2025-10-17",
+			wantDates:     []string{"2025-10-17", "2025-11-01"},
+		},
+		{
+			name: "short history after an empty year",
+			byDate: map[string]int{
+				"2024-03-01": 0,
+				"2025-10-17": 2,
+			},
+			wantTrimmed:   true,
+			wantFirstDate: "2025-10-17",
+			wantDates:     []string{"2025-10-17"},
+		},
+		{
+			name: "no contributions",
+			byDate: map[string]int{
+				"2024-03-01": 0,
+			},
+			wantTrimmed:   false,
+			wantFirstDate: "2024-03-01",
+			wantDates:     []string{"2024-03-01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Contributions{Username: "someuser", ByDate: maps.Clone(tt.byDate)}
+			c.Recompute()
+
+			if trimmed := c.TrimStartYear(); trimmed != tt.wantTrimmed {
+				t.Errorf("got trimmed %v, want %v", trimmed, tt.wantTrimmed)
+			}
+
+			if c.FirstDate != tt.wantFirstDate {
+				t.Errorf("got first date %s, want %s", c.FirstDate, tt.wantFirstDate)
+			}
+
+			if got := sortedKeys(c.ByDate); !slices.Equal(got, tt.wantDates) {
+				t.Errorf("got dates %v, want %v", got, tt.wantDates)
+			}
+
+			if err := c.Validate(); err != nil {
+				t.Errorf("trimmed contributions are invalid: %v", err)
+			}
+		})
+	}
+}
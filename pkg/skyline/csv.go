@@ -0,0 +1,354 @@
+package skyline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AggregateSum   = "sum"
+	AggregateMax   = "max"
+	AggregateMin   = "min"
+	AggregateLast  = "last"
+	AggregateCount = "count"
+
+	// DateFormatUnix parses dates as Unix timestamps in seconds
+	DateFormatUnix = "unix"
+)
+
+func init() {
+	RegisterSource("csv", newCSVSource)
+}
+
+// CSVSource builds contributions from a CSV or TSV time series, like an export
+// from a dashboard or issue tracker
+type CSVSource struct {
+	File     string
+	Username string
+	// Delimiter separates the columns, like ',' or '\t'
+	Delimiter rune
+	// DateColumn is the header name or 1-based index of the date column
+	DateColumn string
+	// CountColumn is the header name or 1-based index of the count column.
+	// If empty, every row counts as one contribution.
+	CountColumn string
+	// DateFormat is a Go time layout, or DateFormatUnix
+	DateFormat string
+	// Location is the timezone dates with a time are bucketed into days with
+	Location *time.Location
+	// Aggregate is how the counts of rows with the same date are combined
+	Aggregate string
+}
+
+// NewCSVSource creates a source for a "date,count" file, or a tab separated
+// one if the file name ends in .tsv
+func NewCSVSource(file string) *CSVSource {
+	delimiter := ','
+	if strings.EqualFold(filepath.Ext(file), ".tsv") {
+		delimiter = '\t'
+	}
+
+	return &CSVSource{
+		File:        file,
+		Username:    strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		Delimiter:   delimiter,
+		DateColumn:  "1",
+		CountColumn: "2",
+		DateFormat:  "2006-01-02",
+		Location:    time.Local,
+		Aggregate:   AggregateSum,
+	}
+}
+
+// newCSVSource creates the csv source for the file in the path, with the
+// "delimiter", "date-column", "count-column", "date-format", "timezone" and
+// "aggregate" options
+func newCSVSource(config SourceConfig) (ContributionsSource, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("the csv source requires the path of a CSV or TSV file")
+	}
+
+	cs := NewCSVSource(config.Path)
+	if len(config.Usernames) > 0 {
+		cs.Username = config.Usernames[0]
+	}
+
+	switch delimiter := config.Option("delimiter", ""); delimiter {
+	case "":
+	case "tab", `\t`:
+		cs.Delimiter = '\t'
+	default:
+		if len([]rune(delimiter)) != 1 {
+			return nil, fmt.Errorf("invalid delimiter option: %q; must be a single character or tab", delimiter)
+		}
+		cs.Delimiter = []rune(delimiter)[0]
+	}
+
+	cs.DateColumn = config.Option("date-column", cs.DateColumn)
+	cs.CountColumn = config.Option("count-column", cs.CountColumn)
+	cs.DateFormat = config.Option("date-format", cs.DateFormat)
+	cs.Aggregate = config.Option("aggregate", cs.Aggregate)
+
+	if cs.Aggregate == AggregateCount {
+		cs.CountColumn = ""
+	}
+
+	loc, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
+	cs.Location = loc
+
+	return cs, nil
+}
+
+func (cs *CSVSource) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	fh, err := os.Open(cs.File)
+	if err != nil {
+		return nil, err
+	}
+
+	defer fh.Close()
+
+	contrib, err := cs.ReadContributions(fh)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", cs.File, err)
+	}
+
+	fmt.Printf("Read %d contributions from %s\n", contrib.TotalContributions, cs.File)
+
+	if startYear == 0 && endYear == 0 {
+		return contrib, nil
+	}
+
+	return contrib.OnlyYears(startYear, endYear), nil
+}
+
+// ReadContributions reads the time series from r.  If the columns are given by
+// name, the first row must be a header.  If they are given by index, the first
+// row is skipped when its date can't be parsed, since it is probably a header.
+func (cs *CSVSource) ReadContributions(r io.Reader) (*Contributions, error) {
+	switch cs.Aggregate {
+	case AggregateSum, AggregateMax, AggregateMin, AggregateLast, AggregateCount:
+	default:
+		return nil, fmt.Errorf("invalid aggregate: %s; must be sum, max, min, last or count", cs.Aggregate)
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = cs.Delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	// The line of each record, since blank lines are skipped and quoted
+	// fields can span several lines
+	records := [][]string{}
+	lines := []int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no rows found")
+	}
+
+	dateCol, dateNamed, err := csvColumn(cs.DateColumn, records[0])
+	if err != nil {
+		return nil, err
+	}
+
+	countCol, countNamed := -1, false
+	if cs.CountColumn != "" && cs.Aggregate != AggregateCount {
+		countCol, countNamed, err = csvColumn(cs.CountColumn, records[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows := records
+	if dateNamed || countNamed {
+		rows, lines = records[1:], lines[1:]
+	} else if dateCol < len(records[0]) {
+		if _, err := cs.parseDate(records[0][dateCol]); err != nil {
+			rows, lines = records[1:], lines[1:]
+		}
+	}
+
+	loc := cs.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	contrib := &Contributions{
+		Username: cs.Username,
+		Timezone: loc.String(),
+		ByDate:   make(map[string]int),
+	}
+
+	for i, row := range rows {
+		line := lines[i]
+
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+
+		if dateCol >= len(row) || countCol >= len(row) {
+			return nil, fmt.Errorf("line %d: expected at least %d columns, found %d", line, max(dateCol, countCol)+1, len(row))
+		}
+
+		date, err := cs.parseDate(row[dateCol])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		count := 1
+		if countCol >= 0 {
+			value, err := strconv.ParseFloat(strings.TrimSpace(row[countCol]), 64)
+			if err != nil || value < 0 {
+				return nil, fmt.Errorf("line %d: invalid count: %q", line, row[countCol])
+			}
+			count = int(math.Round(value))
+		}
+
+		existing, ok := contrib.ByDate[date]
+
+		switch {
+		case !ok || cs.Aggregate == AggregateLast:
+			contrib.ByDate[date] = count
+		case cs.Aggregate == AggregateSum || cs.Aggregate == AggregateCount:
+			contrib.ByDate[date] = existing + count
+		case cs.Aggregate == AggregateMax:
+			contrib.ByDate[date] = max(existing, count)
+		case cs.Aggregate == AggregateMin:
+			contrib.ByDate[date] = min(existing, count)
+		}
+	}
+
+	contrib.Recompute()
+
+	return contrib, nil
+}
+
+func (cs *CSVSource) parseDate(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	loc := cs.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	if cs.DateFormat == DateFormatUnix {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid timestamp: %q", value)
+		}
+
+		return time.Unix(seconds, 0).In(loc).Format("2006-01-02"), nil
+	}
+
+	// Dates without a timezone are taken as they are
+	t, err := time.ParseInLocation(cs.DateFormat, value, loc)
+	if err != nil {
+		return "", fmt.Errorf("invalid date: %q; expected format %s", value, cs.DateFormat)
+	}
+
+	return t.In(loc).Format("2006-01-02"), nil
+}
+
+// csvColumn finds a column by 1-based index or by name in the header row
+func csvColumn(column string, header []string) (int, bool, error) {
+	if index, err := strconv.Atoi(column); err == nil {
+		if index < 1 {
+			return 0, false, fmt.Errorf("invalid column: %d; columns start at 1", index)
+		}
+		return index - 1, false, nil
+	}
+
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i, true, nil
+		}
+	}
+
+	return 0, false, fmt.Errorf("column not found: %s; the header has %v", column, header)
+}
+
+// WriteCSV writes the contributions as a "date,count" time series, with a
+// column for each contribution type if there is a per-type breakdown
+func (c *Contributions) WriteCSV(w io.Writer, delimiter rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+
+	types := []ContributionType{}
+	for _, contribType := range ContributionTypes {
+		if _, ok := c.ByType[contribType]; ok {
+			types = append(types, contribType)
+		}
+	}
+
+	header := []string{"date", "count"}
+	for _, contribType := range types {
+		header = append(header, string(contribType))
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	dates := make([]string, 0, len(c.ByDate))
+	for date := range c.ByDate {
+		dates = append(dates, date)
+	}
+
+	sort.Strings(dates)
+
+	for _, date := range dates {
+		row := []string{date, strconv.Itoa(c.ByDate[date])}
+		for _, contribType := range types {
+			row = append(row, strconv.Itoa(c.ByType[contribType][date]))
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// SaveToCSV writes the contributions to a CSV file, or a TSV file if the file
+// name ends in .tsv
+func (c *Contributions) SaveToCSV(file string) error {
+	fh, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	defer fh.Close()
+
+	delimiter := ','
+	if strings.EqualFold(filepath.Ext(file), ".tsv") {
+		delimiter = '\t'
+	}
+
+	return c.WriteCSV(fh, delimiter)
+}
@@ -0,0 +1,51 @@
+package skyline
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVErrorLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr string
+	}{
+		{
+			name:    "header",
+			csv:     "date,count\n2024-01-01,1\n2024-01-02,x\n",
+			wantErr: "line 3: invalid count",
+		},
+		{
+			name:    "no header",
+			csv:     "2024-01-01,1\n2024-01-02,x\n",
+			wantErr: "line 2: invalid count",
+		},
+		{
+			name:    "blank lines",
+			csv:     "date,count\n\n2024-01-01,1\n\n\n2024-01-02,x\n",
+			wantErr: "line 6: invalid count",
+		},
+		{
+			name:    "multi-line quoted field",
+			csv:     "date,count,note\n2024-01-01,1,\"first\nsecond\"\n2024-13-01,1,\n",
+			wantErr: "line 4: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := NewCSVSource("contributions.csv")
+			cs.Location = time.UTC
+			if strings.HasPrefix(tt.csv, "date,") {
+				cs.DateColumn, cs.CountColumn = "date", "count"
+			}
+
+			_, err := cs.ReadContributions(strings.NewReader(tt.csv))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package skyline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+)
+
+// NotFoundError is returned when a user, organization or repository doesn't
+// exist, or isn't visible with the token
+type NotFoundError struct {
+	// Kind is what wasn't found, like user, organization or repository
+	Kind string
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s not found: %s", e.Kind, e.Name)
+}
+
+// InsufficientScopesError is returned when the token is valid but hasn't been
+// granted the scopes a query needs
+type InsufficientScopesError struct {
+	// Required is the scopes that would allow the query, any one of them is enough
+	Required []string
+	// Granted is the scopes the token has
+	Granted []string
+}
+
+func (e *InsufficientScopesError) Error() string {
+	if len(e.Required) == 0 {
+		return "the token has not been granted the required scopes"
+	}
+
+	return fmt.Sprintf("the token needs one of the scopes %s, but only has %s", strings.Join(e.Required, ", "), scopeList(e.Granted))
+}
+
+// BadCredentialsError is returned when the API rejects the token, because it
+// is wrong, expired or revoked
+type BadCredentialsError struct {
+	// Status is the HTTP status of the response
+	Status string
+}
+
+func (e *BadCredentialsError) Error() string {
+	return fmt.Sprintf("bad credentials: %s", e.Status)
+}
+
+// RateLimitError is returned when the rate limit is still exceeded after
+// retrying as often as the RetryPolicy allows
+type RateLimitError struct {
+	// ResetAt is when the rate limit resets, if the API said so
+	ResetAt time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	if e.ResetAt.IsZero() {
+		return "rate limit exceeded"
+	}
+
+	return fmt.Sprintf("rate limit exceeded until %v", e.ResetAt.Format(time.TimeOnly))
+}
+
+// queryError is a GraphQL error that isn't one of the typed errors, with just
+// the messages from the server instead of the whole debug output
+type queryError struct {
+	messages []string
+	err      error
+}
+
+func (e *queryError) Error() string {
+	return strings.Join(e.messages, "; ")
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+var (
+	notFoundPattern = regexp.MustCompile(`Could not resolve to an? (User|Organization|Repository) with the (?:login|name) of '([^']*)'`)
+	scopesPattern   = regexp.MustCompile(`one of the following scopes: \[([^\]]*)\], but your token has only been granted the: \[([^\]]*)\] scopes`)
+)
+
+// apiError turns an error from the GraphQL client into one of the typed
+// errors if it matches one, and otherwise shortens it to the server's messages
+func apiError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var notFound *NotFoundError
+	var scopes *InsufficientScopesError
+	var badCredentials *BadCredentialsError
+	var rateLimit *RateLimitError
+
+	switch {
+	case errors.As(err, &notFound):
+		return notFound
+	case errors.As(err, &scopes):
+		return scopes
+	case errors.As(err, &badCredentials):
+		return badCredentials
+	case errors.As(err, &rateLimit):
+		return rateLimit
+	case errors.Is(err, ErrNoToken), errors.Is(err, ErrNotCached):
+		return err
+	}
+
+	var gqlErrors graphql.Errors
+	if !errors.As(err, &gqlErrors) {
+		return err
+	}
+
+	messages := make([]string, 0, len(gqlErrors))
+	for _, gqlError := range gqlErrors {
+		if match := notFoundPattern.FindStringSubmatch(gqlError.Message); match != nil {
+			return &NotFoundError{Kind: strings.ToLower(match[1]), Name: match[2]}
+		}
+
+		if strings.Contains(gqlError.Message, "not been granted the required scopes") {
+			scopes := &InsufficientScopesError{}
+			if match := scopesPattern.FindStringSubmatch(gqlError.Message); match != nil {
+				scopes.Required = parseScopes(match[1])
+				scopes.Granted = parseScopes(match[2])
+			}
+			return scopes
+		}
+
+		if strings.Contains(strings.ToLower(gqlError.Message), "rate limit") {
+			return &RateLimitError{}
+		}
+
+		messages = append(messages, gqlError.Message)
+	}
+
+	return &queryError{messages: messages, err: err}
+}
+
+// parseScopes parses a list of scopes like 'repo', 'read:user'
+func parseScopes(list string) []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(list, ",") {
+		scope = strings.Trim(strings.TrimSpace(scope), `'"`)
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+func scopeList(scopes []string) string {
+	if len(scopes) == 0 {
+		return "none"
+	}
+
+	return strings.Join(scopes, ", ")
+}
@@ -0,0 +1,211 @@
+package skyline
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSource("git", newLocalGitSource)
+}
+
+// Commit is a single commit read from a local git repository
+type Commit struct {
+	Hash        string
+	AuthorEmail string
+	// AuthorDate is in the timezone the commit was authored in
+	AuthorDate time.Time
+}
+
+// LocalGitSource builds contributions from the commits in local git
+// repositories, so commits that never reached GitHub can be counted too
+type LocalGitSource struct {
+	Username string
+	// Repositories are the paths of the git repositories to read
+	Repositories []string
+	// Emails are the author emails to count commits for; empty counts all commits
+	Emails []string
+	// Revision is the branch or other revision to read commits from; empty
+	// reads the commits on all branches and tags
+	Revision string
+	// Location is the timezone commits are bucketed into days with
+	Location *time.Location
+	// GitPath is the path to the git executable
+	GitPath string
+}
+
+func NewLocalGitSource(username string, repositories []string, emails []string, location *time.Location) *LocalGitSource {
+	return &LocalGitSource{
+		Username:     username,
+		Repositories: repositories,
+		Emails:       emails,
+		Location:     location,
+		GitPath:      "git",
+	}
+}
+
+// newLocalGitSource creates the git source from the comma separated
+// repositories in the path, with the "emails", "branch", "timezone" and "git"
+// options
+func newLocalGitSource(config SourceConfig) (ContributionsSource, error) {
+	repos := splitList(config.Path)
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("the git source requires the path of one or more git repositories")
+	}
+
+	loc, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	username := "git"
+	if len(config.Usernames) > 0 {
+		username = config.Usernames[0]
+	}
+
+	lgs := NewLocalGitSource(username, repos, splitList(config.Option("emails", "")), loc)
+	lgs.Revision = config.Option("branch", "")
+	lgs.GitPath = config.Option("git", lgs.GitPath)
+
+	return lgs, nil
+}
+
+// Commits returns the commits by the configured authors between startYear and
+// endYear (inclusive) on the revision, or any branch or tag, of the repositories.  Commits that are in
+// more than one repository, like in several clones, are only returned once.
+func (lgs *LocalGitSource) Commits(startYear, endYear int) ([]Commit, error) {
+	emails := make(map[string]bool, len(lgs.Emails))
+	for _, email := range lgs.Emails {
+		emails[strings.ToLower(email)] = true
+	}
+
+	seen := make(map[string]bool)
+	commits := []Commit{}
+	loc := lgs.loc()
+
+	for _, repo := range lgs.Repositories {
+		repoCommits, err := lgs.readCommits(repo)
+		if err != nil {
+			return nil, err
+		}
+
+		found := 0
+		for _, commit := range repoCommits {
+			if seen[commit.Hash] {
+				continue
+			}
+
+			if len(emails) > 0 && !emails[strings.ToLower(commit.AuthorEmail)] {
+				continue
+			}
+
+			year := commit.AuthorDate.In(loc).Year()
+			if (startYear != 0 && year < startYear) || (endYear != 0 && year > endYear) {
+				continue
+			}
+
+			seen[commit.Hash] = true
+			commits = append(commits, commit)
+			found++
+		}
+
+		fmt.Printf("Read %d commits from %s\n", found, repo)
+	}
+
+	return commits, nil
+}
+
+func (lgs *LocalGitSource) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	commits, err := lgs.Commits(startYear, endYear)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := lgs.loc()
+
+	contrib := &Contributions{
+		Username: lgs.Username,
+		Timezone: loc.String(),
+		ByDate:   make(map[string]int),
+	}
+
+	// Commits are bucketed into days in the source's timezone, but like on
+	// GitHub their times are in the timezone each commit was authored in
+	for _, commit := range commits {
+		contrib.ByDate[commit.AuthorDate.In(loc).Format("2006-01-02")]++
+		contrib.AddCommitTime(commit.AuthorDate)
+	}
+
+	contrib.Recompute()
+
+	return contrib, nil
+}
+
+// readCommits reads every commit reachable from the revision, or any branch or
+// tag, in a repository
+func (lgs *LocalGitSource) readCommits(repo string) ([]Commit, error) {
+	// The stash and notes are also refs, but their commits aren't contributions
+	revision := []string{"--exclude=refs/stash", "--exclude=refs/notes/*", "--all"}
+	if lgs.Revision != "" {
+		revision = []string{lgs.Revision}
+	}
+
+	args := append([]string{"-C", repo, "log"}, revision...)
+	cmd := exec.Command(lgs.GitPath, append(args, "--format=%H%x09%ae%x09%aI", "--")...)
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading commits from %s: %w; %s", repo, err, strings.TrimSpace(stderr.String()))
+	}
+
+	commits := []Commit{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid author date in %s: %w", repo, err)
+		}
+
+		commits = append(commits, Commit{
+			Hash:        fields[0],
+			AuthorEmail: fields[1],
+			AuthorDate:  date,
+		})
+	}
+
+	return commits, scanner.Err()
+}
+
+// loc returns the location commits are bucketed into days in
+func (lgs *LocalGitSource) loc() *time.Location {
+	if lgs.Location == nil {
+		return time.Local
+	}
+
+	return lgs.Location
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,132 @@
+package skyline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSource("gitea", newGiteaSource)
+	RegisterSource("forgejo", newGiteaSource)
+}
+
+// GiteaContributionsFetcher fetches contributions from the heatmap of a Gitea
+// or Forgejo instance
+type GiteaContributionsFetcher struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	location *time.Location
+}
+
+// NewGiteaContributionsFetcher creates a fetcher for the Gitea or Forgejo
+// instance at baseURL.  The heatmap timestamps are bucketed into days in the
+// given location.  The token is optional for public profiles.
+func NewGiteaContributionsFetcher(baseURL string, username string, token string, location *time.Location) *GiteaContributionsFetcher {
+	headers := map[string]string{
+		"User-Agent": "github-skyline",
+	}
+
+	if token != "" {
+		headers["Authorization"] = "token " + token
+	}
+
+	return &GiteaContributionsFetcher{
+		client:   newClientWithHeaders(headers, http.DefaultTransport),
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		location: location,
+	}
+}
+
+// newGiteaSource creates the gitea source for the first username with the
+// "timezone" option, using the GITEA_TOKEN environment variable if no token
+// is given
+func newGiteaSource(config SourceConfig) (ContributionsSource, error) {
+	if len(config.Usernames) == 0 {
+		return nil, fmt.Errorf("the gitea source requires a username")
+	}
+
+	if config.URL == "" {
+		return nil, fmt.Errorf("the gitea source requires the URL of the server")
+	}
+
+	loc, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	token := config.Token
+	if token == "" {
+		token = os.Getenv("GITEA_TOKEN")
+	}
+
+	return NewGiteaContributionsFetcher(config.URL, config.Usernames[0], token, loc), nil
+}
+
+// FetchContributions fetches the heatmap and keeps the days between startYear
+// and endYear (inclusive).  A year of 0 leaves that end of the range open.
+// Gitea only keeps about a year of heatmap data.
+func (gf *GiteaContributionsFetcher) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	u := gf.baseURL + "/api/v1/users/" + url.PathEscape(gf.username) + "/heatmap"
+
+	resp, err := gf.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return nil, &BadCredentialsError{Status: resp.Status}
+	case http.StatusNotFound:
+		return nil, &NotFoundError{Kind: "Gitea user", Name: gf.username}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("fetching heatmap for %s: %v; body: %q", gf.username, resp.Status, body)
+	}
+
+	var heatmap []struct {
+		Timestamp     int64 `json:"timestamp"`
+		Contributions int   `json:"contributions"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&heatmap); err != nil {
+		return nil, fmt.Errorf("invalid heatmap for %s: %w", gf.username, err)
+	}
+
+	loc := gf.location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	contrib := &Contributions{
+		Username: gf.username,
+		Timezone: loc.String(),
+		ByDate:   make(map[string]int),
+	}
+
+	for _, entry := range heatmap {
+		t := time.Unix(entry.Timestamp, 0).In(loc)
+		if (startYear != 0 && t.Year() < startYear) || (endYear != 0 && t.Year() > endYear) {
+			continue
+		}
+
+		contrib.ByDate[t.Format("2006-01-02")] += entry.Contributions
+	}
+
+	contrib.Recompute()
+
+	fmt.Printf("Fetched heatmap for %s: found %d contributions\n", gf.username, contrib.TotalContributions)
+
+	return contrib, nil
+}
@@ -2,305 +2,1235 @@ package skyline
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
-	"sort"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hasura/go-graphql-client"
 )
 
 const (
-	githubAPIURL = "https://api.github.com/graphql"
+	githubAPIURL       = "https://api.github.com/graphql"
+	defaultParallelism = 4
 )
 
-type Stats struct {
-	Date  string `json:"date"`
-	Count int    `json:"count"`
+type headerRoundTripper struct {
+	headers      map[string]string
+	roundTripper http.RoundTripper
 }
 
-type StatsCollection []Stats
+func (hrt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	for key, value := range hrt.headers {
+		req.Header.Set(key, value)
+	}
+	return hrt.roundTripper.RoundTrip(req)
+}
 
-func (sc StatsCollection) Max() int {
-	max := 0
-	for _, s := range sc {
-		if s.Count > max {
-			max = s.Count
-		}
+// newClientWithHeaders creates a client that sets the headers on every request
+func newClientWithHeaders(headers map[string]string, roundTripper http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: &headerRoundTripper{
+			headers:      headers,
+			roundTripper: roundTripper,
+		},
 	}
+}
 
-	return max
+// NewGraphQLClient creates a GraphQL client for the GitHub API, configured
+// with the same options as NewGitHubContributionsFetcher.  Without a token or
+// WithTokenSource, the token is read from the gh CLI configuration or ~/.netrc.
+func NewGraphQLClient(token string, opts ...FetcherOption) *graphql.Client {
+	return NewGitHubContributionsFetcher("", token, opts...).client
 }
 
-type Contributions struct {
-	Username           string         `json:"username"`
-	TotalContributions int            `json:"total_contributions"`
-	FirstDate          string         `json:"first_date"`
-	LastDate           string         `json:"last_date"`
-	ByDate             map[string]int `json:"by_date"`
+// newGraphQLClient creates a client that authenticates with tokens from the
+// token source, answering requests from the cache if it is not nil.  The token
+// is set below the cache, so a GitHub App's cached responses outlive its
+// short-lived tokens, but the cache is keyed by the credentials so responses
+// are never shared between them.
+func newGraphQLClient(apiURL string, tokens TokenSource, roundTripper http.RoundTripper, cache *ResponseCache) *graphql.Client {
+	httpClient := newClientWithHeaders(map[string]string{
+		"User-Agent": "github-skyline",
+	}, cache.wrap(tokens, &tokenRoundTripper{
+		source:       tokens,
+		roundTripper: roundTripper,
+	}))
+
+	return graphql.NewClient(apiURL, httpClient).WithDebug(true)
 }
 
-// TrimStartYear trims the contributions to the first year with at least one contribution
-func (c *Contributions) TrimStartYear() bool {
-	firstContributionYear := 0
-	for date, numContribs := range c.ByDate {
+type GitHubContributionsFetcher struct {
+	client         *graphql.Client
+	transport      *retryRoundTripper
+	username       string
+	apiURL         string
+	retryPolicy    RetryPolicy
+	rootCAs        *x509.CertPool
+	proxyURL       *url.URL
+	parallelism    int
+	typeBreakdown  bool
+	commitTimes    bool
+	organization   string
+	organizationID *graphql.ID
+	location       *time.Location
+	cache          *ResponseCache
+	tokenSource    TokenSource
+
+	mu        sync.Mutex
+	rateLimit RateLimit
+}
 
-		if numContribs == 0 {
-			continue
-		}
+// FetcherOption configures a GitHubContributionsFetcher
+type FetcherOption func(*GitHubContributionsFetcher)
 
-		year, err := time.Parse("2006-01-02", date)
-		if err != nil {
-			panic(err)
-		}
+// WithRetryPolicy sets how failed requests are retried
+func WithRetryPolicy(policy RetryPolicy) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.retryPolicy = policy
+	}
+}
 
-		if firstContributionYear == 0 || year.Year() < firstContributionYear {
-			firstContributionYear = year.Year()
-		}
+// WithParallelism sets how many years are fetched concurrently.  GitHub
+// discourages many concurrent requests, so keep this low to avoid secondary
+// rate limits.
+func WithParallelism(parallelism int) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.parallelism = max(parallelism, 1)
 	}
+}
 
-	fmt.Printf("First contribution year: %d\n", firstContributionYear)
+// WithTypeBreakdown also fetches the per-type contribution counts (commits,
+// issues, pull requests, reviews and repositories), see Contributions.ByType.
+// This takes at least 12 extra requests per year.
+func WithTypeBreakdown(enabled bool) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.typeBreakdown = enabled
+	}
+}
 
-	if firstContributionYear == 0 {
-		return false
+// WithOrganization only fetches contributions made to repositories owned by
+// the organization with the given login
+func WithOrganization(login string) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.organization = login
 	}
+}
 
-	for date := range c.ByDate {
-		year, err := time.Parse("2006-01-02", date)
-		if err != nil {
-			panic(err)
-		}
+// WithCommitTimes also fetches the author time of each commit to the default
+// branch of the repositories the user committed to, see Contributions.ByHour.
+// This takes at least one extra request per repository per year.
+func WithCommitTimes(enabled bool) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.commitTimes = enabled
+	}
+}
 
-		if year.Year() < firstContributionYear {
-			delete(c.ByDate, date)
-		}
+// WithAPIURL sets the GraphQL endpoint, for example a GitHub Enterprise Server
+// instance like https://github.example.com/api/graphql.  If a GitHub Enterprise
+// Server URL has no path, /api/graphql is appended, and any github.com or
+// api.github.com URL is the GitHub.com endpoint.
+func WithAPIURL(apiURL string) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.apiURL = normalizeAPIURL(apiURL)
 	}
+}
 
-	firstDate := fmt.Sprintf("%d-01-01", firstContributionYear)
-	if firstDate != c.FirstDate {
-		c.FirstDate = firstDate
-		return true
+// WithRootCAs sets the certificate authorities used to verify the API server,
+// see LoadCACertPool
+func WithRootCAs(pool *x509.CertPool) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.rootCAs = pool
 	}
+}
 
-	return false
+// WithProxyURL sends all requests through the given proxy instead of the
+// proxy from the HTTPS_PROXY/NO_PROXY environment variables
+func WithProxyURL(proxyURL *url.URL) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.proxyURL = proxyURL
+	}
 }
 
-func (c *Contributions) YearRangeText() string {
-	startYear := c.FirstDate[:4]
-	endYear := c.LastDate[:4]
+// WithLocation sets the timezone of the contributions: the current date in it
+// is the last day fetched, and the per-type breakdown and commit history are
+// bucketed into days in it.  The default is the local timezone.
+func WithLocation(loc *time.Location) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.location = loc
+	}
+}
 
-	if startYear == endYear {
-		return startYear
+// WithCache answers requests from the cache when it has them, and stores the
+// responses to other requests in it
+func WithCache(cache *ResponseCache) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.cache = cache
 	}
+}
 
-	return fmt.Sprintf("%s-%s", startYear, endYear)
+// WithTokenSource gets the token from a TokenSource, like a token file or a
+// GitHub App installation, if no token is given
+func WithTokenSource(tokens TokenSource) FetcherOption {
+	return func(gcf *GitHubContributionsFetcher) {
+		gcf.tokenSource = tokens
+	}
 }
 
-func (c *Contributions) PerDay() StatsCollection {
-	dayKeys := make([]string, 0, len(c.ByDate))
-	for key := range c.ByDate {
-		dayKeys = append(dayKeys, key)
+// LoadCACertPool returns the system certificate pool with the PEM encoded
+// certificates from file added to it
+func LoadCACertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
 	}
 
-	// Sort the days
-	sort.Strings(dayKeys)
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
 
-	days := make(StatsCollection, 0, len(c.ByDate))
-	for _, date := range dayKeys {
-		days = append(days, Stats{
-			Date:  date,
-			Count: c.ByDate[date],
-		})
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
 	}
 
-	return days
+	return pool, nil
 }
 
-func (c *Contributions) PerWeek() StatsCollection {
-	weeks := make(map[string]int)
+func normalizeAPIURL(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return apiURL
+	}
 
-	for date, count := range c.ByDate {
-		// Compute week of the year as an integer
-		t, err := time.Parse("2006-01-02", date)
-		if err != nil {
-			panic(err)
-		}
+	// GitHub.com has its GraphQL API on its own host, not under /api
+	switch strings.ToLower(u.Hostname()) {
+	case "github.com", "api.github.com":
+		return githubAPIURL
+	}
 
-		year, week := t.ISOWeek()
-		key := fmt.Sprintf("%d-%02d", year, week)
-		weeks[key] += count
+	if u.Path != "" && u.Path != "/" {
+		return apiURL
 	}
 
-	weekKeys := make([]string, 0, len(weeks))
-	for key := range weeks {
-		weekKeys = append(weekKeys, key)
+	u.Path = "/api/graphql"
+	return u.String()
+}
+
+func NewGitHubContributionsFetcher(username string, token string, opts ...FetcherOption) *GitHubContributionsFetcher {
+	gcf := &GitHubContributionsFetcher{
+		username:    username,
+		apiURL:      githubAPIURL,
+		retryPolicy: DefaultRetryPolicy,
+		parallelism: defaultParallelism,
+		location:    time.Local,
+	}
+
+	for _, opt := range opts {
+		opt(gcf)
 	}
 
-	// Sort the weeks
-	sort.Strings(weekKeys)
+	gcf.transport = newRetryRoundTripper(gcf.retryPolicy, gcf.newTransport())
 
-	weekStats := make(StatsCollection, 0, len(weeks))
-	for _, week := range weekKeys {
-		weekStats = append(weekStats, Stats{
-			Date:  week,
-			Count: weeks[week],
-		})
+	tokens := gcf.tokenSource
+	switch {
+	case token != "":
+		tokens = staticToken(token)
+	case tokens == nil:
+		tokens = StoredToken(gcf.apiURL)
 	}
 
-	return weekStats
+	if app, ok := tokens.(*GitHubAppTokenSource); ok {
+		app.configure(gcf.apiURL, gcf.transport)
+	}
+
+	gcf.client = newGraphQLClient(gcf.apiURL, tokens, gcf.transport, gcf.cache)
+
+	return gcf
 }
 
-func (c *Contributions) SaveToFile(file string) error {
-	fh, err := os.Create(file)
-	if err != nil {
-		return err
+func (gcf *GitHubContributionsFetcher) newTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if gcf.rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: gcf.rootCAs}
 	}
 
-	defer fh.Close()
+	if gcf.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(gcf.proxyURL)
+	}
 
-	return json.NewEncoder(fh).Encode(c)
+	return transport
 }
 
-func NewContributionsFromFile(file string) (*Contributions, error) {
-	fh, err := os.Open(file)
-	if err != nil {
-		return nil, err
+// RateLimit returns the most recent rate limit reported by GitHub
+func (gcf *GitHubContributionsFetcher) RateLimit() RateLimit {
+	gcf.mu.Lock()
+	rl := gcf.rateLimit
+	gcf.mu.Unlock()
+
+	if rl.Limit == 0 {
+		return gcf.transport.RateLimit()
 	}
 
-	defer fh.Close()
+	return rl
+}
 
-	contribs := &Contributions{}
-	err = json.NewDecoder(fh).Decode(contribs)
-	if err != nil {
-		return nil, err
+// updateRateLimit records the rate limit reported by a query, unless a more
+// recent one was already recorded by a concurrent query
+func (gcf *GitHubContributionsFetcher) updateRateLimit(rl RateLimit) RateLimit {
+	gcf.mu.Lock()
+	defer gcf.mu.Unlock()
+
+	if gcf.rateLimit.ResetAt.Equal(rl.ResetAt) && gcf.rateLimit.Remaining < rl.Remaining {
+		return gcf.rateLimit
 	}
 
-	return contribs, nil
+	gcf.rateLimit = rl
+	return rl
 }
 
-type headerRoundTripper struct {
-	headers      map[string]string
-	roundTripper http.RoundTripper
-}
+// waitForRateLimit sleeps until the rate limit resets if the remaining budget
+// is not enough for another query like the last one
+func (gcf *GitHubContributionsFetcher) waitForRateLimit(ctx context.Context) error {
+	gcf.mu.Lock()
+	rl := gcf.rateLimit
+	gcf.mu.Unlock()
 
-func (hrt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	for key, value := range hrt.headers {
-		req.Header.Set(key, value)
+	if rl.Limit == 0 || rl.Remaining >= rl.Cost {
+		return nil
 	}
-	return hrt.roundTripper.RoundTrip(req)
-}
 
-func newClientWithHeaders(headers map[string]string) *http.Client {
-	return &http.Client{
-		Transport: &headerRoundTripper{
-			headers:      headers,
-			roundTripper: http.DefaultTransport,
-		},
+	wait := rl.ResetAt.Sub(gcf.transport.now()) + time.Second
+	if wait <= 0 {
+		return nil
 	}
+
+	fmt.Printf("Rate limit exhausted (%v), waiting %v\n", rl, wait.Round(time.Second))
+
+	return gcf.transport.sleep(ctx, wait)
 }
 
-func NewGraphQLClient(token string) *graphql.Client {
-	httpClient := newClientWithHeaders(map[string]string{
-		"Authorization": "Bearer " + token,
-		"User-Agent":    "github-skyline",
-	})
+// query runs a GraphQL query, returning the typed errors for failures like a
+// user that doesn't exist or a token without the required scopes
+func (gcf *GitHubContributionsFetcher) query(ctx context.Context, q any, variables map[string]any) error {
+	return apiError(gcf.client.Query(ctx, q, variables))
+}
 
-	return graphql.NewClient(githubAPIURL, httpClient).WithDebug(true)
+// execRaw runs a GraphQL query from a string and returns the raw data
+func (gcf *GitHubContributionsFetcher) execRaw(ctx context.Context, query string, variables map[string]any) ([]byte, error) {
+	data, err := gcf.client.ExecRaw(ctx, query, variables)
+	return data, apiError(err)
 }
 
-type GitHubContributionsFetcher struct {
-	client   *graphql.Client
-	username string
+type graphQLRateLimit struct {
+	Cost      graphql.Int
+	Limit     graphql.Int
+	Remaining graphql.Int
+	Used      graphql.Int
+	ResetAt   DateTime
 }
 
-func NewGitHubContributionsFetcher(username string, token string) *GitHubContributionsFetcher {
-	return &GitHubContributionsFetcher{
-		client:   NewGraphQLClient(token),
-		username: username,
+func (rl graphQLRateLimit) toRateLimit() RateLimit {
+	return RateLimit{
+		Limit:     int(rl.Limit),
+		Remaining: int(rl.Remaining),
+		Used:      int(rl.Used),
+		Cost:      int(rl.Cost),
+		ResetAt:   rl.ResetAt.Time,
 	}
 }
 
 type DateTime struct{ time.Time }
 
+type GitTimestamp struct{ time.Time }
+
+// resolveOrganization looks up the ID of the organization contributions are
+// limited to, if any
+func (gcf *GitHubContributionsFetcher) resolveOrganization() error {
+	if gcf.organization == "" || gcf.organizationID != nil {
+		return nil
+	}
+
+	var query struct {
+		Organization *struct {
+			ID graphql.ID
+		} `graphql:"organization(login: $login)"`
+	}
+
+	var variables = map[string]any{
+		"login": graphql.String(gcf.organization),
+	}
+
+	err := gcf.query(context.Background(), &query, variables)
+	if err != nil {
+		return fmt.Errorf("looking up organization %s: %w", gcf.organization, err)
+	}
+
+	if query.Organization == nil {
+		return &NotFoundError{Kind: "organization", Name: gcf.organization}
+	}
+
+	gcf.organizationID = &query.Organization.ID
+	fmt.Printf("Only fetching contributions to %s repositories\n", gcf.organization)
+
+	return nil
+}
+
+// FetchContributionYears returns the first and last year the user has
+// contributions for, falling back to the account creation year and the
+// current year if GitHub reports no contribution years at all.
+func (gcf *GitHubContributionsFetcher) FetchContributionYears() (int, int, error) {
+	if err := gcf.resolveOrganization(); err != nil {
+		return 0, 0, err
+	}
+
+	var query struct {
+		User struct {
+			CreatedAt               DateTime
+			ContributionsCollection struct {
+				ContributionYears []graphql.Int
+			} `graphql:"contributionsCollection(organizationID: $organizationID)"`
+		} `graphql:"user(login: $username)"`
+	}
+
+	var variables = map[string]any{
+		"username":       graphql.String(gcf.username),
+		"organizationID": gcf.organizationID,
+	}
+
+	err := gcf.query(context.Background(), &query, variables)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	firstYear := 0
+	lastYear := 0
+	for _, year := range query.User.ContributionsCollection.ContributionYears {
+		if firstYear == 0 || int(year) < firstYear {
+			firstYear = int(year)
+		}
+
+		if int(year) > lastYear {
+			lastYear = int(year)
+		}
+	}
+
+	if firstYear == 0 {
+		lastYear = time.Now().In(gcf.location).Year()
+		firstYear = lastYear
+		if createdYear := query.User.CreatedAt.Year(); createdYear > 1 {
+			firstYear = createdYear
+		}
+	}
+
+	return firstYear, lastYear, nil
+}
+
+// FetchContributions fetches the contributions between startYear and endYear
+// (inclusive).  The range is always discovered from the user's contribution
+// years, and any non-zero year only narrows it.
 func (gcf *GitHubContributionsFetcher) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	if err := gcf.resolveOrganization(); err != nil {
+		return nil, err
+	}
+
+	startYear, endYear, err := resolveYearRange(startYear, endYear, gcf.FetchContributionYears)
+	if err != nil {
+		return nil, err
+	}
+
+	years := make([]int, 0, max(endYear-startYear+1, 0))
+	for year := startYear; year <= endYear; year++ {
+		years = append(years, year)
+	}
+
+	return gcf.fetchYears(years)
+}
+
+// UpdateContributions brings existing contributions up to date by fetching
+// only the current year, the year existing was last fetched in (if it was
+// fetched part way through the year) and any years it has no data for, or no
+// breakdown for if the breakdown is enabled.
+// The new data is merged into existing, which is returned.
+func (gcf *GitHubContributionsFetcher) UpdateContributions(existing *Contributions, startYear, endYear int) (*Contributions, error) {
+	if existing.Username != "" && !strings.EqualFold(existing.Username, gcf.username) {
+		return nil, fmt.Errorf("existing contributions are for %s, not %s", existing.Username, gcf.username)
+	}
+
+	if existing.Organization != gcf.organization {
+		return nil, fmt.Errorf("existing contributions are for organization %q, not %q", existing.Organization, gcf.organization)
+	}
+
+	if existing.Timezone != "" && existing.Timezone != gcf.location.String() {
+		return nil, fmt.Errorf("existing contributions are in timezone %s, not %s", existing.Timezone, gcf.location)
+	}
+
+	if err := gcf.resolveOrganization(); err != nil {
+		return nil, err
+	}
+
+	startYear, endYear, err := resolveYearRange(startYear, endYear, gcf.FetchContributionYears)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the breakdown and commit times complete for the years that are fetched again
+	if len(existing.ByType) > 0 {
+		gcf.typeBreakdown = true
+	}
+
+	if len(existing.ByHour) > 0 {
+		gcf.commitTimes = true
+	}
+
+	haveYears := make(map[int]bool)
+	for date := range existing.ByDate {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date in existing contributions: %w", err)
+		}
+
+		haveYears[t.Year()] = true
+	}
+
+	partialYear := 0
+	if lastDate, err := time.Parse("2006-01-02", existing.LastDate); err == nil {
+		if lastDate.Month() != time.December || lastDate.Day() != 31 {
+			partialYear = lastDate.Year()
+		}
+	}
+
+	// Years fetched before the breakdown was enabled are fetched again with it
+	missingBreakdown := map[int]bool{}
+	if gcf.typeBreakdown {
+		for _, year := range existing.yearsWithoutBreakdown() {
+			missingBreakdown[year] = true
+		}
+	}
+
+	thisYear := time.Now().In(gcf.location).Year()
+
+	years := []int{}
+	for year := startYear; year <= endYear; year++ {
+		if !haveYears[year] || year == partialYear || year == thisYear || missingBreakdown[year] {
+			years = append(years, year)
+		}
+	}
+
+	if len(years) == 0 {
+		fmt.Printf("Contributions are already up to date\n")
+		return existing, nil
+	}
+
+	fetched, err := gcf.fetchYears(years)
+	if err != nil {
+		return nil, err
+	}
+
+	existing.Username = gcf.username
+	existing.Timezone = fetched.Timezone
+	existing.Merge(fetched)
+
+	return existing, nil
+}
+
+// fetchYears fetches the given years concurrently and merges them together
+func (gcf *GitHubContributionsFetcher) fetchYears(years []int) (*Contributions, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make([]*Contributions, len(years))
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var fetchErr error
+
+	for range min(gcf.parallelism, len(years)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				yearContrib, err := gcf.fetchYear(ctx, years[i])
+				if err != nil {
+					errOnce.Do(func() {
+						fetchErr = err
+						cancel()
+					})
+					continue
+				}
+
+				results[i] = yearContrib
+			}
+		}()
+	}
+
+feed:
+	for i := range years {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
 
 	contrib := &Contributions{
-		Username: gcf.username,
-		ByDate:   make(map[string]int),
-	}
-
-	var firstDate time.Time
-	var lastDate time.Time
-
-	thisYear := startYear
-	for thisYear <= endYear {
-		var query struct {
-			User struct {
-				ContributionsCollection struct {
-					ContributionCalendar struct {
-						TotalContributions graphql.Int
-						Weeks              []struct {
-							ContributionDays []struct {
-								ContributionCount graphql.Int
-								Date              graphql.String
-							}
+		Username:     gcf.username,
+		Organization: gcf.organization,
+		Timezone:     gcf.location.String(),
+		ByDate:       make(map[string]int),
+	}
+
+	// Merge in year order so the result doesn't depend on which request finished first
+	for _, yearContrib := range results {
+		contrib.Merge(yearContrib)
+	}
+
+	return contrib, nil
+}
+
+// fetchYear fetches the contribution calendar for a single year
+func (gcf *GitHubContributionsFetcher) fetchYear(ctx context.Context, year int) (*Contributions, error) {
+	var query struct {
+		RateLimit graphQLRateLimit
+		User      struct {
+			ContributionsCollection struct {
+				RestrictedContributionsCount graphql.Int
+				ContributionCalendar         struct {
+					TotalContributions graphql.Int
+					Weeks              []struct {
+						ContributionDays []struct {
+							ContributionCount graphql.Int
+							Date              graphql.String
 						}
 					}
-				} `graphql:"contributionsCollection(from: $start)"`
-			} `graphql:"user(login: $username)"`
+				}
+			} `graphql:"contributionsCollection(from: $start, organizationID: $organizationID)"`
+		} `graphql:"user(login: $username)"`
+	}
+
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var variables = map[string]any{
+		"username":       graphql.String(gcf.username),
+		"start":          DateTime{start},
+		"organizationID": gcf.organizationID,
+	}
+
+	if err := gcf.waitForRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	err := gcf.query(ctx, &query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("fetching contributions from %d: %w", year, err)
+	}
+
+	rateLimit := gcf.updateRateLimit(query.RateLimit.toRateLimit())
+
+	restricted := int(query.User.ContributionsCollection.RestrictedContributionsCount)
+
+	fmt.Printf("Fetched contributions from %v: found %d, %d restricted (rate limit: %v)\n", year, query.User.ContributionsCollection.ContributionCalendar.TotalContributions, restricted, rateLimit)
+
+	contrib := &Contributions{
+		Username:         gcf.username,
+		Organization:     gcf.organization,
+		Timezone:         gcf.location.String(),
+		ByDate:           make(map[string]int),
+		RestrictedByYear: map[int]int{year: restricted},
+	}
+
+	// The calendar has GitHub's own days, so only the last day depends on the location
+	lastDay := today(gcf.location)
+
+	for _, week := range query.User.ContributionsCollection.ContributionCalendar.Weeks {
+		for _, day := range week.ContributionDays {
+			// Skip contributions from the future
+			if string(day.Date) > lastDay {
+				continue
+			}
+
+			contrib.ByDate[string(day.Date)] = int(day.ContributionCount)
 		}
+	}
 
-		start := time.Date(thisYear, 1, 1, 0, 0, 0, 0, time.UTC)
+	if gcf.typeBreakdown {
+		contrib.ByType, err = gcf.fetchYearBreakdown(ctx, year)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Fetched contribution breakdown for %v\n", year)
 
-		fmt.Printf("Fetching contributions from %v...", thisYear)
+		contrib.attributeRestricted(year)
+	}
 
-		var variables = map[string]any{
-			"username": graphql.String(gcf.username),
-			"start":    DateTime{start},
+	if gcf.commitTimes {
+		times, err := gcf.fetchYearCommitTimes(ctx, year)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range times {
+			contrib.AddCommitTime(t)
 		}
 
-		err := gcf.client.Query(context.Background(), &query, variables)
+		fmt.Printf("Fetched %d commit times for %v\n", len(times), year)
+	}
+
+	return contrib, nil
+}
+
+// fetchYearCommitTimes fetches the author times of the user's commits in a year
+// to the default branches of the repositories they committed to.  The times
+// keep the author's timezone, so they show when the author was working.
+func (gcf *GitHubContributionsFetcher) fetchYearCommitTimes(ctx context.Context, year int) ([]time.Time, error) {
+	since := time.Date(year, 1, 1, 0, 0, 0, 0, gcf.location)
+	until := since.AddDate(1, 0, 0).Add(-time.Second)
+
+	author, repos, err := gcf.fetchCommittedRepositories(ctx, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("fetching repositories committed to in %d: %w", year, err)
+	}
+
+	times := []time.Time{}
+	for _, repo := range repos {
+		repoTimes, err := gcf.fetchHistory(ctx, repo.owner, repo.name, author, &GitTimestamp{since}, &GitTimestamp{until})
 		if err != nil {
 			return nil, err
 		}
 
-		fmt.Printf(" found %d\n", query.User.ContributionsCollection.ContributionCalendar.TotalContributions)
+		times = append(times, repoTimes...)
+	}
 
-		for _, week := range query.User.ContributionsCollection.ContributionCalendar.Weeks {
-			for _, day := range week.ContributionDays {
-				date, err := time.Parse("2006-01-02", string(day.Date))
-				if err != nil {
-					return nil, err
+	return times, nil
+}
+
+type repositoryName struct {
+	owner string
+	name  string
+}
+
+// fetchCommittedRepositories returns the author to look up the user's commits
+// with, and the repositories they committed to between from and to.
+// commitContributionsByRepository can't be paginated, so if the range has more
+// repositories than fit in one response, each half of it is fetched on its own.
+func (gcf *GitHubContributionsFetcher) fetchCommittedRepositories(ctx context.Context, from, to time.Time) (*CommitAuthor, []repositoryName, error) {
+	var query struct {
+		RateLimit graphQLRateLimit
+		User      struct {
+			ID                      graphql.ID
+			ContributionsCollection struct {
+				CommitContributionsByRepository []struct {
+					Repository struct {
+						Name  graphql.String
+						Owner struct {
+							Login graphql.String
+						}
+					}
+				} `graphql:"commitContributionsByRepository(maxRepositories: 100)"`
+			} `graphql:"contributionsCollection(from: $from, to: $to, organizationID: $organizationID)"`
+		} `graphql:"user(login: $username)"`
+	}
+
+	variables := map[string]any{
+		"username":       graphql.String(gcf.username),
+		"from":           DateTime{from},
+		"to":             DateTime{to},
+		"organizationID": gcf.organizationID,
+	}
+
+	if err := gcf.waitForRateLimit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	if err := gcf.query(ctx, &query, variables); err != nil {
+		return nil, nil, err
+	}
+
+	gcf.updateRateLimit(query.RateLimit.toRateLimit())
+
+	author := &CommitAuthor{ID: query.User.ID}
+	byRepository := query.User.ContributionsCollection.CommitContributionsByRepository
+
+	if len(byRepository) >= maxCommitRepositories {
+		if mid, ok := splitDays(from, to); ok {
+			_, first, err := gcf.fetchCommittedRepositories(ctx, from, mid.Add(-time.Second))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			_, second, err := gcf.fetchCommittedRepositories(ctx, mid, to)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// Most repositories are committed to in both halves
+			repos := first
+			for _, repo := range second {
+				if !slices.Contains(repos, repo) {
+					repos = append(repos, repo)
 				}
+			}
 
-				// Skip contributions from the future
-				if date.After(time.Now()) {
-					continue
+			return author, repos, nil
+		}
+
+		fmt.Printf("Committed to more than %d repositories on %s, only using the first %d\n", maxCommitRepositories, from.Format("2006-01-02"), maxCommitRepositories)
+	}
+
+	repos := make([]repositoryName, 0, len(byRepository))
+	for _, repo := range byRepository {
+		repos = append(repos, repositoryName{owner: string(repo.Repository.Owner.Login), name: string(repo.Repository.Name)})
+	}
+
+	return author, repos, nil
+}
+
+// CommitAuthor limits a commit history to the commits of one author
+type CommitAuthor struct {
+	ID graphql.ID `json:"id"`
+}
+
+// fetchHistory fetches the author times of the commits to the default branch of
+// a repository, a page at a time.  A nil author, since or until doesn't limit
+// the history.
+func (gcf *GitHubContributionsFetcher) fetchHistory(ctx context.Context, owner, name string, author *CommitAuthor, since, until *GitTimestamp) ([]time.Time, error) {
+	var query struct {
+		RateLimit  graphQLRateLimit
+		Repository struct {
+			DefaultBranchRef *struct {
+				Target struct {
+					Commit struct {
+						History struct {
+							TotalCount graphql.Int
+							PageInfo   struct {
+								HasNextPage graphql.Boolean
+								EndCursor   graphql.String
+							}
+							Nodes []struct {
+								AuthoredDate DateTime
+							}
+						} `graphql:"history(first: 100, after: $cursor, author: $author, since: $since, until: $until)"`
+					} `graphql:"... on Commit"`
+				}
+			}
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+
+	variables := map[string]any{
+		"owner":  graphql.String(owner),
+		"name":   graphql.String(name),
+		"author": author,
+		"since":  since,
+		"until":  until,
+		"cursor": (*graphql.String)(nil),
+	}
+
+	times := []time.Time{}
+	for {
+		if err := gcf.waitForRateLimit(ctx); err != nil {
+			return nil, err
+		}
+
+		err := gcf.query(ctx, &query, variables)
+		if err != nil {
+			return nil, fmt.Errorf("fetching commits to %s/%s: %w", owner, name, err)
+		}
+
+		gcf.updateRateLimit(query.RateLimit.toRateLimit())
+
+		if query.Repository.DefaultBranchRef == nil {
+			return times, nil
+		}
+
+		history := query.Repository.DefaultBranchRef.Target.Commit.History
+		for _, node := range history.Nodes {
+			times = append(times, node.AuthoredDate.Time)
+		}
+
+		if !history.PageInfo.HasNextPage {
+			return times, nil
+		}
+
+		fmt.Printf("Fetched %d of %d commits to %s/%s\n", len(times), history.TotalCount, owner, name)
+
+		cursor := history.PageInfo.EndCursor
+		variables["cursor"] = &cursor
+	}
+}
+
+// maxCommitRepositories is the most repositories commitContributionsByRepository
+// returns, which is what the queries ask for
+const maxCommitRepositories = 100
+
+// typeConnections maps the contributionsCollection connections that list
+// individual contributions to their contribution type
+var typeConnections = map[string]ContributionType{
+	"issueContributions":             ContributionTypeIssues,
+	"pullRequestContributions":       ContributionTypePullRequests,
+	"pullRequestReviewContributions": ContributionTypeReviews,
+	"repositoryContributions":        ContributionTypeRepositories,
+}
+
+const (
+	breakdownQuery = `query($username:String!,$from:DateTime!,$to:DateTime!,$organizationID:ID){` +
+		`rateLimit{cost,limit,remaining,used,resetAt}` +
+		`user(login:$username){contributionsCollection(from:$from,to:$to,organizationID:$organizationID){` +
+		commitBreakdownSelection +
+		`issueContributions(first:100){pageInfo{hasNextPage,endCursor}nodes{occurredAt}}` +
+		`pullRequestContributions(first:100){pageInfo{hasNextPage,endCursor}nodes{occurredAt}}` +
+		`pullRequestReviewContributions(first:100){pageInfo{hasNextPage,endCursor}nodes{occurredAt}}` +
+		`repositoryContributions(first:100){pageInfo{hasNextPage,endCursor}nodes{occurredAt}}` +
+		`}}}`
+
+	commitBreakdownQuery = `query($username:String!,$from:DateTime!,$to:DateTime!,$organizationID:ID){` +
+		`rateLimit{cost,limit,remaining,used,resetAt}` +
+		`user(login:$username){contributionsCollection(from:$from,to:$to,organizationID:$organizationID){` +
+		commitBreakdownSelection +
+		`}}}`
+
+	commitBreakdownSelection = `commitContributionsByRepository(maxRepositories:100){contributions(first:100){pageInfo{hasNextPage,endCursor}nodes{occurredAt,commitCount}}}`
+
+	connectionPageQuery = `query($username:String!,$from:DateTime!,$to:DateTime!,$organizationID:ID,$cursor:String){` +
+		`rateLimit{cost,limit,remaining,used,resetAt}` +
+		`user(login:$username){contributionsCollection(from:$from,to:$to,organizationID:$organizationID){` +
+		`%s(first:100,after:$cursor){pageInfo{hasNextPage,endCursor}nodes{occurredAt}}` +
+		`}}}`
+)
+
+type contributionConnection struct {
+	PageInfo struct {
+		HasNextPage bool
+		EndCursor   string
+	}
+	Nodes []struct {
+		OccurredAt  time.Time
+		CommitCount int
+	}
+}
+
+type commitRepositoryContributions struct {
+	Contributions contributionConnection
+}
+
+type breakdownResponse struct {
+	RateLimit struct {
+		Cost      int
+		Limit     int
+		Remaining int
+		Used      int
+		ResetAt   time.Time
+	}
+	User struct {
+		ContributionsCollection struct {
+			CommitContributionsByRepository []commitRepositoryContributions
+			Connections                     map[string]contributionConnection `json:"-"`
+		}
+	}
+}
+
+// fetchYearBreakdown fetches the per-type contribution counts for a single
+// year.  It is fetched a month at a time so the commits for each repository
+// fit in a single page, and months with commits to more repositories than fit
+// in a response are split up further.
+func (gcf *GitHubContributionsFetcher) fetchYearBreakdown(ctx context.Context, year int) (map[ContributionType]map[string]int, error) {
+	byType := make(map[ContributionType]map[string]int)
+	for _, contribType := range ContributionTypes {
+		byType[contribType] = make(map[string]int)
+	}
+
+	for month := time.January; month <= time.December; month++ {
+		from := time.Date(year, month, 1, 0, 0, 0, 0, gcf.location)
+		if from.After(time.Now()) {
+			break
+		}
+
+		to := from.AddDate(0, 1, 0).Add(-time.Second)
+
+		variables := map[string]any{
+			"username":       gcf.username,
+			"from":           from,
+			"to":             to,
+			"organizationID": gcf.organizationID,
+		}
+
+		resp, err := gcf.queryBreakdown(ctx, breakdownQuery, variables)
+		if err != nil {
+			return nil, fmt.Errorf("fetching contribution breakdown for %d-%02d: %w", year, month, err)
+		}
+
+		repos := resp.User.ContributionsCollection.CommitContributionsByRepository
+		if commitsComplete(repos) {
+			gcf.addCommits(byType[ContributionTypeCommits], repos)
+		} else if err := gcf.fetchCommitBreakdown(ctx, from, to, byType[ContributionTypeCommits]); err != nil {
+			return nil, fmt.Errorf("fetching commits for %d-%02d: %w", year, month, err)
+		}
+
+		for field, contribType := range typeConnections {
+			conn := resp.User.ContributionsCollection.Connections[field]
+			for {
+				for _, node := range conn.Nodes {
+					byType[contribType][node.OccurredAt.In(gcf.location).Format("2006-01-02")]++
 				}
 
-				if firstDate.IsZero() || date.Before(firstDate) {
-					firstDate = date
+				if !conn.PageInfo.HasNextPage {
+					break
 				}
 
-				if lastDate.IsZero() || date.After(lastDate) {
-					lastDate = date
+				variables["cursor"] = conn.PageInfo.EndCursor
+				page, err := gcf.queryBreakdown(ctx, fmt.Sprintf(connectionPageQuery, field), variables)
+				if err != nil {
+					return nil, fmt.Errorf("fetching %s for %d-%02d: %w", contribType, year, month, err)
 				}
 
-				contrib.ByDate[string(day.Date)] = int(day.ContributionCount)
+				delete(variables, "cursor")
+				conn = page.User.ContributionsCollection.Connections[field]
 			}
 		}
+	}
+
+	return byType, nil
+}
 
-		thisYear++
+// fetchCommitBreakdown adds the number of commits on each day between from
+// and to to byDate.  commitContributionsByRepository can't be paginated, so if
+// the range has more repositories, or more days in a repository, than fit in
+// one response, each half of the range is fetched on its own.
+func (gcf *GitHubContributionsFetcher) fetchCommitBreakdown(ctx context.Context, from, to time.Time, byDate map[string]int) error {
+	variables := map[string]any{
+		"username":       gcf.username,
+		"from":           from,
+		"to":             to,
+		"organizationID": gcf.organizationID,
 	}
 
-	for _, count := range contrib.ByDate {
-		contrib.TotalContributions += count
+	resp, err := gcf.queryBreakdown(ctx, commitBreakdownQuery, variables)
+	if err != nil {
+		return err
 	}
 
-	contrib.FirstDate = firstDate.Format("2006-01-02")
-	contrib.LastDate = lastDate.Format("2006-01-02")
+	repos := resp.User.ContributionsCollection.CommitContributionsByRepository
+	if !commitsComplete(repos) {
+		if mid, ok := splitDays(from, to); ok {
+			if err := gcf.fetchCommitBreakdown(ctx, from, mid.Add(-time.Second), byDate); err != nil {
+				return err
+			}
 
-	return contrib, nil
+			return gcf.fetchCommitBreakdown(ctx, mid, to, byDate)
+		}
+
+		fmt.Printf("Committed to more than %d repositories on %s, only counting the first %d\n", maxCommitRepositories, from.Format("2006-01-02"), maxCommitRepositories)
+	}
+
+	gcf.addCommits(byDate, repos)
+
+	return nil
+}
+
+// addCommits adds the commits in each repository to the days they were made on
+func (gcf *GitHubContributionsFetcher) addCommits(byDate map[string]int, repos []commitRepositoryContributions) {
+	for _, repo := range repos {
+		for _, node := range repo.Contributions.Nodes {
+			byDate[node.OccurredAt.In(gcf.location).Format("2006-01-02")] += node.CommitCount
+		}
+	}
+}
+
+// commitsComplete reports whether a commitContributionsByRepository response
+// has every repository and every day of them
+func commitsComplete(repos []commitRepositoryContributions) bool {
+	if len(repos) >= maxCommitRepositories {
+		return false
+	}
+
+	for _, repo := range repos {
+		if repo.Contributions.PageInfo.HasNextPage {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitDays returns the start of the middle day of a range, to split it in two
+// halves of whole days.  A range within one day can't be split.
+func splitDays(from, to time.Time) (time.Time, bool) {
+	days := int(utcDate(to).Sub(utcDate(from)).Hours()/24) + 1
+	if days < 2 {
+		return time.Time{}, false
+	}
+
+	return time.Date(from.Year(), from.Month(), from.Day()+days/2, 0, 0, 0, 0, from.Location()), true
+}
+
+// queryBreakdown runs one of the breakdown queries.  The connections are
+// decoded into a map since the page queries only select one of them.
+func (gcf *GitHubContributionsFetcher) queryBreakdown(ctx context.Context, query string, variables map[string]any) (*breakdownResponse, error) {
+	if err := gcf.waitForRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	data, err := gcf.execRaw(ctx, query, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &breakdownResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		User struct {
+			ContributionsCollection map[string]json.RawMessage
+		}
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	resp.User.ContributionsCollection.Connections = make(map[string]contributionConnection)
+	for field := range typeConnections {
+		rawConn, ok := raw.User.ContributionsCollection[field]
+		if !ok {
+			continue
+		}
+
+		var conn contributionConnection
+		if err := json.Unmarshal(rawConn, &conn); err != nil {
+			return nil, err
+		}
+
+		resp.User.ContributionsCollection.Connections[field] = conn
+	}
+
+	rl := resp.RateLimit
+	gcf.updateRateLimit(RateLimit{
+		Limit:     rl.Limit,
+		Remaining: rl.Remaining,
+		Used:      rl.Used,
+		Cost:      rl.Cost,
+		ResetAt:   rl.ResetAt,
+	})
+
+	return resp, nil
+}
+
+func init() {
+	RegisterSource("github", newGitHubSource)
+}
+
+// gitHubSource fetches the contributions of a user, a team of users or all the
+// members of an organization from the GitHub API
+type gitHubSource struct {
+	fetcher     *GitHubContributionsFetcher
+	usernames   []string
+	team        string
+	orgMembers  string
+	partialFile string
+}
+
+// newGitHubSource creates the github source.  Besides the usernames, it
+// supports the "org-members" option to fetch every member of an organization,
+// with progress saved to the "partial-file" option.
+func newGitHubSource(config SourceConfig) (ContributionsSource, error) {
+	gs := &gitHubSource{
+		usernames:   config.Usernames,
+		team:        config.Team,
+		orgMembers:  config.Option("org-members", ""),
+		partialFile: config.Option("partial-file", ""),
+	}
+
+	opts := config.GitHubOptions
+	if config.URL != "" {
+		opts = append(opts, WithAPIURL(config.URL))
+	}
+
+	username := ""
+	if len(gs.usernames) > 0 {
+		username = gs.usernames[0]
+	}
+
+	gs.fetcher = NewGitHubContributionsFetcher(username, config.Token, opts...)
+
+	return gs, nil
+}
+
+func (gs *gitHubSource) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	return gs.UpdateContributions(nil, startYear, endYear)
+}
+
+func (gs *gitHubSource) UpdateContributions(existing *Contributions, startYear, endYear int) (*Contributions, error) {
+	if gs.orgMembers != "" {
+		return gs.fetchOrganization(existing, startYear, endYear)
+	}
+
+	if existing != nil && existing.IsTeam() {
+		team := gs.team
+		if team == "" {
+			team = existing.Username
+		}
+
+		// Every saved member is updated, so none of them are lost, along with
+		// any new ones
+		usernames := UniqueUsernames(append(existing.MemberNames(), gs.usernames...))
+
+		return gs.fetcher.FetchTeamContributions(team, usernames, existing, startYear, endYear)
+	}
+
+	if len(gs.usernames) == 0 {
+		return nil, fmt.Errorf("the github source requires a username")
+	}
+
+	if gs.team != "" || len(gs.usernames) > 1 {
+		return gs.fetcher.FetchTeamContributions(gs.team, gs.usernames, existing, startYear, endYear)
+	}
+
+	if existing != nil {
+		return gs.fetcher.UpdateContributions(existing, startYear, endYear)
+	}
+
+	return gs.fetcher.FetchContributions(startYear, endYear)
+}
+
+func (gs *gitHubSource) fetchOrganization(existing *Contributions, startYear, endYear int) (*Contributions, error) {
+	contribs, failed, err := gs.fetcher.FetchOrganizationContributions(gs.orgMembers, existing, gs.partialFile, startYear, endYear)
+	if err != nil {
+		if gs.partialFile != "" {
+			fmt.Printf("Partial results are saved in %s, run the same command again to resume\n", gs.partialFile)
+		}
+		return nil, err
+	}
+
+	if gs.team != "" {
+		contribs.Username = gs.team
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("Could not fetch contributions for %d members: %s\n", len(failed), strings.Join(failed, ", "))
+		if gs.partialFile != "" {
+			fmt.Printf("Partial results are saved in %s, run the same command again to retry them\n", gs.partialFile)
+		}
+	} else if gs.partialFile != "" {
+		os.Remove(gs.partialFile)
+	}
+
+	return contribs, nil
 }
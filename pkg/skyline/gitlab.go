@@ -0,0 +1,243 @@
+package skyline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	gitlabURL = "https://gitlab.com"
+
+	// gitlabEventYears is how many years of events GitLab keeps
+	gitlabEventYears = 3
+)
+
+func init() {
+	RegisterSource("gitlab", newGitLabSource)
+}
+
+// GitLabContributionsFetcher fetches contributions from the events API and
+// contribution calendar of a GitLab instance
+type GitLabContributionsFetcher struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	location *time.Location
+}
+
+// NewGitLabContributionsFetcher creates a fetcher for the GitLab instance at
+// baseURL, like https://gitlab.com.  Events are bucketed into days in the given
+// location.  The token is optional for public profiles.
+func NewGitLabContributionsFetcher(baseURL string, username string, token string, location *time.Location) *GitLabContributionsFetcher {
+	headers := map[string]string{
+		"User-Agent": "github-skyline",
+	}
+
+	if token != "" {
+		headers["PRIVATE-TOKEN"] = token
+	}
+
+	return &GitLabContributionsFetcher{
+		client:   newClientWithHeaders(headers, http.DefaultTransport),
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		location: location,
+	}
+}
+
+// newGitLabSource creates the gitlab source for the first username with the
+// "timezone" option, using the GITLAB_TOKEN environment variable if no token
+// is given
+func newGitLabSource(config SourceConfig) (ContributionsSource, error) {
+	if len(config.Usernames) == 0 {
+		return nil, fmt.Errorf("the gitlab source requires a username")
+	}
+
+	baseURL := config.URL
+	if baseURL == "" {
+		baseURL = gitlabURL
+	}
+
+	loc, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	token := config.Token
+	if token == "" {
+		token = os.Getenv("GITLAB_TOKEN")
+	}
+
+	return NewGitLabContributionsFetcher(baseURL, config.Usernames[0], token, loc), nil
+}
+
+// FetchContributionYears returns the year the user was created and the current
+// year.  If GitLab doesn't say when the user was created, the first year is the
+// oldest year GitLab keeps events for.
+func (glf *GitLabContributionsFetcher) FetchContributionYears() (int, int, error) {
+	var users []struct {
+		CreatedAt *time.Time `json:"created_at"`
+	}
+
+	err := glf.get("/api/v4/users", url.Values{"username": {glf.username}}, &users)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(users) == 0 {
+		return 0, 0, &NotFoundError{Kind: "GitLab user", Name: glf.username}
+	}
+
+	thisYear := time.Now().In(glf.loc()).Year()
+	if users[0].CreatedAt == nil {
+		return thisYear - gitlabEventYears + 1, thisYear, nil
+	}
+
+	return users[0].CreatedAt.Year(), thisYear, nil
+}
+
+// FetchContributions fetches the contributions between startYear and endYear
+// (inclusive), with the same year range semantics as the GitHub fetcher.
+// Each event counts as one contribution, like in the GitLab calendar, and the
+// calendar counts replace the event counts for the last year it covers.
+func (glf *GitLabContributionsFetcher) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	startYear, endYear, err := resolveYearRange(startYear, endYear, glf.FetchContributionYears)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := glf.loc()
+
+	contrib := &Contributions{
+		Username: glf.username,
+		Timezone: loc.String(),
+		ByDate:   make(map[string]int),
+	}
+
+	if startYear > endYear {
+		return contrib, nil
+	}
+
+	lastDay := today(loc)
+
+	for year := startYear; year <= endYear; year++ {
+		events, err := glf.fetchYearEvents(year)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			date := event.CreatedAt.In(loc).Format("2006-01-02")
+			if date <= lastDay {
+				contrib.ByDate[date]++
+			}
+		}
+
+		fmt.Printf("Fetched contributions from %v: found %d\n", year, len(events))
+	}
+
+	calendar, err := glf.fetchCalendar()
+	if err != nil {
+		return nil, fmt.Errorf("fetching the contribution calendar: %w", err)
+	}
+
+	for date, count := range calendar {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date in contribution calendar: %w", err)
+		}
+
+		if t.Year() >= startYear && t.Year() <= endYear && date <= lastDay {
+			contrib.ByDate[date] = count
+		}
+	}
+
+	contrib.Recompute()
+
+	return contrib, nil
+}
+
+// loc returns the location events are bucketed into days in
+func (glf *GitLabContributionsFetcher) loc() *time.Location {
+	if glf.location == nil {
+		return time.Local
+	}
+
+	return glf.location
+}
+
+type gitlabEvent struct {
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// fetchYearEvents fetches all the user's events in a year, a page at a time
+func (glf *GitLabContributionsFetcher) fetchYearEvents(year int) ([]gitlabEvent, error) {
+	query := url.Values{
+		"after":    {fmt.Sprintf("%d-12-31", year-1)},
+		"before":   {fmt.Sprintf("%d-01-01", year+1)},
+		"per_page": {"100"},
+		"page":     {"1"},
+	}
+
+	events := []gitlabEvent{}
+	for {
+		var page []gitlabEvent
+		header, err := glf.getWithHeader("/api/v4/users/"+url.PathEscape(glf.username)+"/events", query, &page)
+		if err != nil {
+			return nil, fmt.Errorf("fetching events from %d: %w", year, err)
+		}
+
+		events = append(events, page...)
+
+		nextPage := header.Get("X-Next-Page")
+		if nextPage == "" || len(page) == 0 {
+			return events, nil
+		}
+
+		query.Set("page", nextPage)
+	}
+}
+
+// fetchCalendar fetches the contribution calendar shown on the user's profile,
+// which covers the last year
+func (glf *GitLabContributionsFetcher) fetchCalendar() (map[string]int, error) {
+	calendar := map[string]int{}
+	err := glf.get("/users/"+url.PathEscape(glf.username)+"/calendar.json", nil, &calendar)
+	return calendar, err
+}
+
+func (glf *GitLabContributionsFetcher) get(path string, query url.Values, v any) error {
+	_, err := glf.getWithHeader(path, query, v)
+	return err
+}
+
+func (glf *GitLabContributionsFetcher) getWithHeader(path string, query url.Values, v any) (http.Header, error) {
+	u := glf.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	resp, err := glf.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, &BadCredentialsError{Status: resp.Status}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GET %s: %v; body: %q", path, resp.Status, body)
+	}
+
+	return resp.Header, json.NewDecoder(resp.Body).Decode(v)
+}
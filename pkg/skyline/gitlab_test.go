@@ -0,0 +1,205 @@
+package skyline
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newGitLabStandIn serves the recorded GitLab API responses in
+// testdata/gitlab for the user someuser.  Event pages that weren't recorded
+// are empty, and calendarStatus replaces the calendar with an error if it is
+// not 200.
+func newGitLabStandIn(t *testing.T, calendarStatus int) *httptest.Server {
+	serveFile := func(w http.ResponseWriter, name string) {
+		data, err := os.ReadFile(filepath.Join("testdata", "gitlab", name))
+		if err != nil {
+			t.Errorf("missing recorded response: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "glpat-test" {
+			http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+
+		switch r.URL.Path {
+		case "/api/v4/users":
+			if query.Get("username") != "someuser" {
+				w.Write([]byte("[]"))
+				return
+			}
+
+			serveFile(w, "users.json")
+
+		case "/api/v4/users/someuser/events":
+			year := strings.TrimSuffix(query.Get("before"), "-01-01")
+			switch {
+			case year == "2023" && query.Get("after") == "2021-12-31":
+				serveFile(w, "events-2022.json")
+			case year == "2024" && query.Get("page") == "1":
+				w.Header().Set("X-Next-Page", "2")
+				serveFile(w, "events-2023-page-1.json")
+			case year == "2024" && query.Get("page") == "2":
+				w.Header().Set("X-Next-Page", "")
+				serveFile(w, "events-2023-page-2.json")
+			default:
+				w.Write([]byte("[]"))
+			}
+
+		case "/users/someuser/calendar.json":
+			if calendarStatus != http.StatusOK {
+				http.Error(w, http.StatusText(calendarStatus), calendarStatus)
+				return
+			}
+
+			serveFile(w, "calendar.json")
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGitLabFetchContributions(t *testing.T) {
+	server := newGitLabStandIn(t, http.StatusOK)
+	fetcher := NewGitLabContributionsFetcher(server.URL+"/", "someuser", "glpat-test", time.UTC)
+
+	contribs, err := fetcher.FetchContributions(2022, 2023)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]int{
+		"2022-03-15": 1,
+		"2022-11-02": 2,
+		// The calendar counts replace the event counts
+		"2023-06-01": 2,
+		"2023-12-30": 4,
+	}
+
+	if len(contribs.ByDate) != len(want) {
+		t.Errorf("got %d dates %v, want %v", len(contribs.ByDate), contribs.ByDate, want)
+	}
+
+	for date, count := range want {
+		if contribs.ByDate[date] != count {
+			t.Errorf("got %d contributions on %s, want %d", contribs.ByDate[date], date, count)
+		}
+	}
+
+	if contribs.TotalContributions != 9 || contribs.FirstDate != "2022-03-15" || contribs.LastDate != "2023-12-30" {
+		t.Errorf("got %d contributions between %s and %s, want 9 between 2022-03-15 and 2023-12-30",
+			contribs.TotalContributions, contribs.FirstDate, contribs.LastDate)
+	}
+
+	if contribs.Username != "someuser" || contribs.Timezone != "UTC" {
+		t.Errorf("got username %q in timezone %q", contribs.Username, contribs.Timezone)
+	}
+}
+
+func TestGitLabFetchContributionsDiscoversYears(t *testing.T) {
+	server := newGitLabStandIn(t, http.StatusOK)
+	fetcher := NewGitLabContributionsFetcher(server.URL, "someuser", "glpat-test", time.UTC)
+
+	first, last, err := fetcher.FetchContributionYears()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first != 2022 || last != time.Now().UTC().Year() {
+		t.Errorf("got years %d-%d, want 2022-%d", first, last, time.Now().UTC().Year())
+	}
+
+	// The end year only narrows the discovered range
+	contribs, err := fetcher.FetchContributions(0, 2022)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contribs.TotalContributions != 3 || contribs.FirstDate != "2022-03-15" || contribs.LastDate != "2022-11-02" {
+		t.Errorf("got %d contributions between %s and %s, want 3 between 2022-03-15 and 2022-11-02",
+			contribs.TotalContributions, contribs.FirstDate, contribs.LastDate)
+	}
+}
+
+func TestGitLabFetchContributionsOutsideYears(t *testing.T) {
+	server := newGitLabStandIn(t, http.StatusOK)
+	fetcher := NewGitLabContributionsFetcher(server.URL, "someuser", "glpat-test", time.UTC)
+
+	// Years before the account existed are empty rather than an error, so
+	// they don't fail a whole team
+	contribs, err := fetcher.FetchContributions(2015, 2018)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contribs.TotalContributions != 0 || len(contribs.ByDate) != 0 || contribs.Username != "someuser" {
+		t.Errorf("got %d contributions for %q, want none for someuser", contribs.TotalContributions, contribs.Username)
+	}
+}
+
+func TestGitLabFetchContributionsTimezone(t *testing.T) {
+	server := newGitLabStandIn(t, http.StatusOK)
+
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+
+	fetcher := NewGitLabContributionsFetcher(server.URL, "someuser", "glpat-test", sydney)
+
+	contribs, err := fetcher.FetchContributions(2022, 2022)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 23:30 UTC is the next morning in Sydney
+	if contribs.ByDate["2022-03-16"] != 1 || contribs.ByDate["2022-03-15"] != 0 {
+		t.Errorf("got %v, want the late event on 2022-03-16", contribs.ByDate)
+	}
+}
+
+func TestGitLabFetchContributionsCalendarError(t *testing.T) {
+	server := newGitLabStandIn(t, http.StatusInternalServerError)
+	fetcher := NewGitLabContributionsFetcher(server.URL, "someuser", "glpat-test", time.UTC)
+
+	_, err := fetcher.FetchContributions(2022, 2023)
+	if err == nil || !strings.Contains(err.Error(), "contribution calendar") {
+		t.Errorf("got error %v, want the calendar error", err)
+	}
+}
+
+func TestGitLabFetchContributionsErrors(t *testing.T) {
+	server := newGitLabStandIn(t, http.StatusOK)
+
+	_, err := NewGitLabContributionsFetcher(server.URL, "nobody", "glpat-test", time.UTC).FetchContributions(0, 0)
+
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || notFound.Name != "nobody" {
+		t.Errorf("got error %v, want a NotFoundError for nobody", err)
+	}
+
+	_, err = NewGitLabContributionsFetcher(server.URL, "someuser", "wrong", time.UTC).FetchContributions(2022, 2023)
+
+	var badCredentials *BadCredentialsError
+	if !errors.As(err, &badCredentials) {
+		t.Errorf("got error %v, want a BadCredentialsError", err)
+	}
+}
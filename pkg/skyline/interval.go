@@ -0,0 +1,299 @@
+package skyline
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntervalUnit is the unit of time of an Interval
+type IntervalUnit string
+
+const (
+	UnitDay     = IntervalUnit("day")
+	UnitWeek    = IntervalUnit("week")
+	UnitMonth   = IntervalUnit("month")
+	UnitQuarter = IntervalUnit("quarter")
+	UnitYear    = IntervalUnit("year")
+)
+
+// Interval is the period of time each building of a skyline covers
+type Interval struct {
+	Unit IntervalUnit
+	// Count is the number of units in each building, which can only be more
+	// than 1 for days
+	Count int
+}
+
+var (
+	IntervalDay     = Interval{Unit: UnitDay, Count: 1}
+	IntervalWeek    = Interval{Unit: UnitWeek, Count: 1}
+	IntervalMonth   = Interval{Unit: UnitMonth, Count: 1}
+	IntervalQuarter = Interval{Unit: UnitQuarter, Count: 1}
+	IntervalYear    = Interval{Unit: UnitYear, Count: 1}
+)
+
+// IntervalDays returns an interval of n days
+func IntervalDays(n int) Interval {
+	return Interval{Unit: UnitDay, Count: n}
+}
+
+// daysIntervalPattern matches custom intervals of days, like 14d or 10days
+var daysIntervalPattern = regexp.MustCompile(`^(\d+) ?d(ays?)?$`)
+
+// ParseInterval parses the name of an interval (day, week, month, quarter or
+// year), or a number of days like 14d
+func ParseInterval(name string) (Interval, error) {
+	for _, interval := range []Interval{IntervalDay, IntervalWeek, IntervalMonth, IntervalQuarter, IntervalYear} {
+		if IntervalUnit(name) == interval.Unit {
+			return interval, nil
+		}
+	}
+
+	if match := daysIntervalPattern.FindStringSubmatch(name); match != nil {
+		days, err := strconv.Atoi(match[1])
+		if err == nil && days > 0 {
+			return IntervalDays(days), nil
+		}
+	}
+
+	return Interval{}, fmt.Errorf("invalid interval: %s; must be day, week, month, quarter, year or a number of days like 14d", name)
+}
+
+func (i Interval) String() string {
+	if i.Unit == UnitDay && i.Count > 1 {
+		return fmt.Sprintf("%dd", i.Count)
+	}
+
+	return string(i.Unit)
+}
+
+// SeriesOptions control how contributions are summed into buildings
+type SeriesOptions struct {
+	// WeekStart is the first day of each week.  Monday buckets weeks by ISO
+	// week, and Sunday matches the columns of the GitHub calendar.
+	WeekStart time.Weekday
+	// FillGaps adds an empty building for every interval between FirstDate
+	// and LastDate without contributions, so the buildings are evenly spaced
+	FillGaps bool
+	// PadWeeks extends the range to whole weeks starting on WeekStart, with
+	// empty buildings for the days added.  It implies FillGaps, and only
+	// applies to intervals of days and weeks.
+	PadWeeks bool
+}
+
+// DefaultSeriesOptions uses ISO weeks, and has a building for every interval
+// between FirstDate and LastDate
+var DefaultSeriesOptions = SeriesOptions{WeekStart: time.Monday, FillGaps: true}
+
+// Per returns the contributions summed into buildings of the interval, with
+// the DefaultSeriesOptions
+func (c *Contributions) Per(interval Interval) (StatsCollection, error) {
+	return c.Series(interval, DefaultSeriesOptions)
+}
+
+// Series returns the contributions summed into buildings of the interval
+func (c *Contributions) Series(interval Interval, opts SeriesOptions) (StatsCollection, error) {
+	if interval.Count < 1 || (interval.Count > 1 && interval.Unit != UnitDay) {
+		return nil, fmt.Errorf("invalid interval: %d %ss; only days can be grouped", interval.Count, interval.Unit)
+	}
+
+	fill := opts.FillGaps || opts.PadWeeks
+
+	// Padded days before the first or after the last day would fall into
+	// periods of their own with coarser intervals
+	if interval.Unit != UnitDay && interval.Unit != UnitWeek {
+		opts.PadWeeks = false
+	}
+
+	start, end := c.seriesRange(opts)
+
+	var bucket func(t time.Time) string
+	switch interval.Unit {
+	case UnitDay:
+		bucket = dayBucket
+		if interval.Count > 1 {
+			bucket = daysBucket(start, interval.Count)
+		}
+	case UnitWeek:
+		bucket = weekBucket(opts.WeekStart)
+	case UnitMonth:
+		bucket = monthBucket
+	case UnitQuarter:
+		bucket = quarterBucket
+	case UnitYear:
+		bucket = yearBucket
+	default:
+		return nil, fmt.Errorf("invalid interval: %s", interval)
+	}
+
+	return c.series(bucket, start, end, fill), nil
+}
+
+// PerMonth sums the contributions by month, like 2024-01
+func (c *Contributions) PerMonth() StatsCollection {
+	return c.aggregate(monthBucket)
+}
+
+// PerQuarter sums the contributions by quarter, like 2024-Q1
+func (c *Contributions) PerQuarter() StatsCollection {
+	return c.aggregate(quarterBucket)
+}
+
+// PerYear sums the contributions by year
+func (c *Contributions) PerYear() StatsCollection {
+	return c.aggregate(yearBucket)
+}
+
+// PerDays sums the contributions into buckets of n days starting on the
+// FirstDate, each labeled with its first day
+func (c *Contributions) PerDays(n int) StatsCollection {
+	start, _ := c.seriesRange(SeriesOptions{})
+
+	return c.aggregate(daysBucket(start, n))
+}
+
+func dayBucket(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// daysBucket labels each day with the first day of its bucket of n days
+func daysBucket(start time.Time, n int) func(t time.Time) string {
+	first := utcDate(start)
+
+	return func(t time.Time) string {
+		days := int(utcDate(t).Sub(first).Hours() / 24)
+
+		bucket := days / n
+		if days < 0 && days%n != 0 {
+			bucket--
+		}
+
+		return first.AddDate(0, 0, bucket*n).Format("2006-01-02")
+	}
+}
+
+// weekBucket labels each day with its ISO week like 2024-05 for weeks
+// starting on Monday, and otherwise with the first day of its week
+func weekBucket(weekStart time.Weekday) func(t time.Time) string {
+	if weekStart == time.Monday {
+		return func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}
+	}
+
+	return func(t time.Time) string {
+		return t.AddDate(0, 0, -daysSinceWeekStart(t, weekStart)).Format("2006-01-02")
+	}
+}
+
+func monthBucket(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+func quarterBucket(t time.Time) string {
+	return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+}
+
+func yearBucket(t time.Time) string {
+	return t.Format("2006")
+}
+
+// seriesRange returns the first and last day of a series, extended to whole
+// weeks if the options pad them.  They are zero if there are no contributions.
+func (c *Contributions) seriesRange(opts SeriesOptions) (time.Time, time.Time) {
+	start, err := time.Parse("2006-01-02", c.FirstDate)
+	if err != nil {
+		return time.Time{}, time.Time{}
+	}
+
+	end, err := time.Parse("2006-01-02", c.LastDate)
+	if err != nil {
+		return time.Time{}, time.Time{}
+	}
+
+	if opts.PadWeeks {
+		start = start.AddDate(0, 0, -daysSinceWeekStart(start, opts.WeekStart))
+		end = end.AddDate(0, 0, 6-daysSinceWeekStart(end, opts.WeekStart))
+	}
+
+	return start, end
+}
+
+// daysSinceWeekStart returns how many days t is after the start of its week
+func daysSinceWeekStart(t time.Time, weekStart time.Weekday) int {
+	return (int(t.Weekday()) - int(weekStart) + 7) % 7
+}
+
+// utcDate returns the date of t at midnight UTC, so days can be counted
+// without daylight saving time getting in the way
+func utcDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ParseWeekday parses the name of a day of the week, like sunday or Sun
+func ParseWeekday(name string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) || strings.EqualFold(name, day.String()[:3]) {
+			return day, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid day of the week: %s", name)
+}
+
+// aggregate sums the counts of each date into the bucket returned for it, and
+// returns the buckets sorted by their keys
+func (c *Contributions) aggregate(bucket func(t time.Time) string) StatsCollection {
+	return c.series(bucket, time.Time{}, time.Time{}, false)
+}
+
+// series sums the counts of each date into the bucket returned for it.  If
+// fill is set, every day from start to end adds its bucket too, even if it has
+// no contributions.  The buckets are sorted by their keys.
+func (c *Contributions) series(bucket func(t time.Time) string, start, end time.Time, fill bool) StatsCollection {
+	counts := make(map[string]int)
+	restricted := make(map[string]int)
+
+	// The dates were already bucketed into days in the contributions' timezone,
+	// so they are only calendar dates here
+	for date, count := range c.ByDate {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			panic(err)
+		}
+
+		key := bucket(t)
+		counts[key] += count
+		restricted[key] += c.Restricted[date]
+	}
+
+	if fill && !start.IsZero() {
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			key := bucket(day)
+			counts[key] += 0
+		}
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	stats := make(StatsCollection, 0, len(counts))
+	for _, key := range keys {
+		stats = append(stats, Stats{
+			Date:       key,
+			Count:      counts[key],
+			Restricted: restricted[key],
+		})
+	}
+
+	return stats
+}
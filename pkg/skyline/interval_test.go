@@ -0,0 +1,272 @@
+package skyline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Interval
+		wantErr bool
+	}{
+		{name: "day", want: IntervalDay},
+		{name: "week", want: IntervalWeek},
+		{name: "month", want: IntervalMonth},
+		{name: "quarter", want: IntervalQuarter},
+		{name: "year", want: IntervalYear},
+		{name: "14d", want: IntervalDays(14)},
+		{name: "10days", want: IntervalDays(10)},
+		{name: "1 day", want: IntervalDays(1)},
+		{name: "0d", wantErr: true},
+		{name: "2w", wantErr: true},
+		{name: "days", wantErr: true},
+		{name: "Week", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInterval(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("got %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntervalString(t *testing.T) {
+	for interval, want := range map[Interval]string{
+		IntervalDay:      "day",
+		IntervalDays(14): "14d",
+		IntervalQuarter:  "quarter",
+	} {
+		if got := interval.String(); got != want {
+			t.Errorf("got %q for %#v, want %q", got, interval, want)
+		}
+	}
+}
+
+func testDate(t *testing.T, date string) time.Time {
+	t.Helper()
+
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return day
+}
+
+func TestBuckets(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket func(t time.Time) string
+		dates  map[string]string
+	}{
+		{
+			// Days before the start fall into buckets that end on the day
+			// before it, not into the first one
+			name:   "7 days",
+			bucket: daysBucket(time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), 7),
+			dates: map[string]string{
+				"2024-01-10": "2024-01-10",
+				"2024-01-16": "2024-01-10",
+				"2024-01-17": "2024-01-17",
+				"2024-01-09": "2024-01-03",
+				"2024-01-03": "2024-01-03",
+				"2024-01-02": "2023-12-27",
+			},
+		},
+		{
+			name:   "7 days across a daylight saving change",
+			bucket: daysBucket(time.Date(2024, 3, 1, 0, 0, 0, 0, mustLoadLocation(t, "Europe/Berlin")), 7),
+			dates: map[string]string{
+				"2024-03-07": "2024-03-01",
+				"2024-03-29": "2024-03-29",
+				"2024-04-04": "2024-03-29",
+			},
+		},
+		{
+			name:   "ISO weeks",
+			bucket: weekBucket(time.Monday),
+			dates: map[string]string{
+				"2024-05-06": "2024-19",
+				"2024-05-12": "2024-19",
+				// The ISO year of the days around new year can differ
+				"2024-12-30": "2025-01",
+				"2021-01-03": "2020-53",
+			},
+		},
+		{
+			name:   "Sunday weeks",
+			bucket: weekBucket(time.Sunday),
+			dates: map[string]string{
+				"2024-05-05": "2024-05-05",
+				"2024-05-11": "2024-05-05",
+				"2024-12-31": "2024-12-29",
+				"2025-01-04": "2024-12-29",
+				"2025-01-05": "2025-01-05",
+			},
+		},
+		{
+			name:   "months",
+			bucket: monthBucket,
+			dates:  map[string]string{"2024-12-31": "2024-12", "2025-01-01": "2025-01"},
+		},
+		{
+			name:   "quarters",
+			bucket: quarterBucket,
+			dates:  map[string]string{"2024-03-31": "2024-Q1", "2024-04-01": "2024-Q2", "2024-12-31": "2024-Q4"},
+		},
+		{
+			name:   "years",
+			bucket: yearBucket,
+			dates:  map[string]string{"2024-12-31": "2024", "2025-01-01": "2025"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for date, want := range tt.dates {
+				if got := tt.bucket(testDate(t, date)); got != want {
+					t.Errorf("got %s for %s, want %s", got, date, want)
+				}
+			}
+		})
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+
+	return loc
+}
+
+func TestSeriesPerDays(t *testing.T) {
+	c := newTestContributions("someuser", "UTC", map[string]int{
+		"2024-12-30": 1,
+		"2025-01-01": 2,
+		"2025-01-02": 3,
+		"2025-01-08": 4,
+	})
+
+	stats, err := c.Series(IntervalDays(3), SeriesOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The buckets start on the first date, and are labeled with their first day
+	want := StatsCollection{
+		{Date: "2024-12-30", Count: 3},
+		{Date: "2025-01-02", Count: 3},
+		{Date: "2025-01-08", Count: 4},
+	}
+
+	if len(stats) != len(want) {
+		t.Fatalf("got %v, want %v", stats, want)
+	}
+
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("got %v, want %v", stats[i], want[i])
+		}
+	}
+
+	if _, err := c.Series(Interval{Unit: UnitWeek, Count: 2}, SeriesOptions{}); err == nil {
+		t.Errorf("grouped several weeks")
+	}
+}
+
+func TestSeriesFillGapsAndPadWeeks(t *testing.T) {
+	// A Wednesday to a Wednesday a year later, so padding to whole weeks adds
+	// days in the years before and after
+	c := newTestContributions("someuser", "UTC", map[string]int{
+		"2025-01-01": 1,
+		"2025-03-15": 2,
+		"2025-12-31": 3,
+	})
+
+	noGaps := SeriesOptions{WeekStart: time.Monday}
+	fill := SeriesOptions{WeekStart: time.Monday, FillGaps: true}
+	pad := SeriesOptions{WeekStart: time.Monday, PadWeeks: true}
+	padSunday := SeriesOptions{WeekStart: time.Sunday, PadWeeks: true}
+
+	tests := []struct {
+		name        string
+		interval    Interval
+		opts        SeriesOptions
+		wantBuckets int
+		wantFirst   string
+		wantLast    string
+	}{
+		{"day", IntervalDay, noGaps, 3, "2025-01-01", "2025-12-31"},
+		{"day filled", IntervalDay, fill, 365, "2025-01-01", "2025-12-31"},
+		{"day padded", IntervalDay, pad, 371, "2024-12-30", "2026-01-04"},
+		{"day padded to Sundays", IntervalDay, padSunday, 371, "2024-12-29", "2026-01-03"},
+		{"7 days filled", IntervalDays(7), fill, 53, "2025-01-01", "2025-12-31"},
+		{"7 days padded", IntervalDays(7), pad, 53, "2024-12-30", "2025-12-29"},
+		{"week", IntervalWeek, noGaps, 3, "2025-01", "2026-01"},
+		{"week filled", IntervalWeek, fill, 53, "2025-01", "2026-01"},
+		{"week padded", IntervalWeek, pad, 53, "2025-01", "2026-01"},
+		{"week padded to Sundays", IntervalWeek, padSunday, 53, "2024-12-29", "2025-12-28"},
+		// Padding doesn't apply to coarser intervals, which would get a
+		// building for a few padded days of another year
+		{"month filled", IntervalMonth, fill, 12, "2025-01", "2025-12"},
+		{"month padded", IntervalMonth, pad, 12, "2025-01", "2025-12"},
+		{"quarter padded", IntervalQuarter, pad, 4, "2025-Q1", "2025-Q4"},
+		{"year padded", IntervalYear, pad, 1, "2025", "2025"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := c.Series(tt.interval, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(stats) != tt.wantBuckets {
+				t.Fatalf("got %d buckets, want %d", len(stats), tt.wantBuckets)
+			}
+
+			if stats[0].Date != tt.wantFirst || stats[len(stats)-1].Date != tt.wantLast {
+				t.Errorf("got buckets %s to %s, want %s to %s", stats[0].Date, stats[len(stats)-1].Date, tt.wantFirst, tt.wantLast)
+			}
+
+			total := 0
+			for _, s := range stats {
+				total += s.Count
+			}
+
+			if total != c.TotalContributions {
+				t.Errorf("got %d contributions in the buckets, want %d", total, c.TotalContributions)
+			}
+		})
+	}
+}
+
+func TestSeriesDefaults(t *testing.T) {
+	c := newTestContributions("someuser", "UTC", map[string]int{"2025-10-17": 1, "2025-10-31": 1})
+
+	// The default fills the gaps between the first and last date only
+	stats, err := c.Per(IntervalWeek)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(stats) != 3 || stats[0].Date != "2025-42" || stats[2].Date != "2025-44" {
+		t.Errorf("got %v, want weeks 2025-42 to 2025-44", stats)
+	}
+}
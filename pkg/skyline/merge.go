@@ -0,0 +1,235 @@
+package skyline
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MergeStrategy is how MergeContributions combines the counts for a date that
+// is in several contributions
+type MergeStrategy string
+
+const (
+	// MergeSum adds the counts, for contributions of different accounts
+	MergeSum = MergeStrategy("sum")
+	// MergeMax uses the highest count, for overlapping exports of one account
+	MergeMax = MergeStrategy("max")
+	// MergeNewest uses the count from the contributions with the latest
+	// LastDate, for snapshots of one account taken over time
+	MergeNewest = MergeStrategy("newest")
+)
+
+var MergeStrategies = []MergeStrategy{MergeSum, MergeMax, MergeNewest}
+
+// ParseMergeStrategy parses the name of a merge strategy
+func ParseMergeStrategy(name string) (MergeStrategy, error) {
+	for _, strategy := range MergeStrategies {
+		if MergeStrategy(name) == strategy {
+			return strategy, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid merge strategy: %s; must be one of %v", name, MergeStrategies)
+}
+
+// MergeContributions combines several contributions into one with the given
+// strategy.  The username, organization and repository are kept if they are
+// the same in all of them, and team members are merged by username.  The
+// contributions must be in the same timezone, or have none recorded, and the
+// merged contributions are validated before they are returned.
+func MergeContributions(strategy MergeStrategy, contribs ...*Contributions) (*Contributions, error) {
+	if len(contribs) == 0 {
+		return nil, fmt.Errorf("no contributions to merge")
+	}
+
+	if _, err := ParseMergeStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+
+	merged := &Contributions{
+		Username:     contribs[0].Username,
+		Organization: contribs[0].Organization,
+		Repository:   contribs[0].Repository,
+		ByDate:       make(map[string]int),
+	}
+
+	usernames := []string{}
+	for _, c := range contribs {
+		if c.Timezone != "" && merged.Timezone != "" && c.Timezone != merged.Timezone {
+			return nil, fmt.Errorf("can't merge contributions in timezone %s with contributions in %s", c.Timezone, merged.Timezone)
+		}
+
+		if merged.Timezone == "" {
+			merged.Timezone = c.Timezone
+		}
+
+		if c.Organization != merged.Organization {
+			merged.Organization = ""
+		}
+
+		if c.Repository != merged.Repository {
+			merged.Repository = ""
+		}
+
+		if !slices.Contains(usernames, c.Username) {
+			usernames = append(usernames, c.Username)
+		}
+	}
+
+	merged.Username = strings.Join(usernames, ", ")
+
+	if strategy == MergeNewest {
+		// Merge oldest first, so the newest counts replace the others
+		ordered := append([]*Contributions{}, contribs...)
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].LastDate < ordered[j].LastDate })
+
+		for _, c := range ordered {
+			merged.Merge(c)
+		}
+	} else {
+		combine := func(a, b int) int { return a + b }
+		if strategy == MergeMax {
+			combine = func(a, b int) int { return max(a, b) }
+		}
+
+		for _, c := range contribs {
+			merged.combine(c, combine)
+		}
+	}
+
+	members := map[string][]*Contributions{}
+	for _, c := range contribs {
+		for username, member := range c.Members {
+			members[username] = append(members[username], member)
+		}
+	}
+
+	for username, list := range members {
+		member, err := MergeContributions(strategy, list...)
+		if err != nil {
+			return nil, fmt.Errorf("merging member %s: %w", username, err)
+		}
+
+		if merged.Members == nil {
+			merged.Members = make(map[string]*Contributions, len(members))
+		}
+
+		merged.Members[username] = member
+	}
+
+	merged.Recompute()
+
+	if problems := merged.validate(""); len(problems) > 0 {
+		return nil, &ValidationError{File: "the merged contributions", Problems: problems}
+	}
+
+	return merged, nil
+}
+
+// combine combines every count in other with the count in c for the same
+// date, type, hour or year
+func (c *Contributions) combine(other *Contributions, combine func(a, b int) int) {
+	for date, count := range other.ByDate {
+		c.ByDate[date] = combine(c.ByDate[date], count)
+	}
+
+	for contribType, byDate := range other.ByType {
+		if c.ByType == nil {
+			c.ByType = make(map[ContributionType]map[string]int)
+		}
+
+		if c.ByType[contribType] == nil {
+			c.ByType[contribType] = make(map[string]int)
+		}
+
+		for date, count := range byDate {
+			c.ByType[contribType][date] = combine(c.ByType[contribType][date], count)
+		}
+	}
+
+	for date, hours := range other.ByHour {
+		if c.ByHour == nil {
+			c.ByHour = make(map[string][24]int)
+		}
+
+		combined := c.ByHour[date]
+		for hour, count := range hours {
+			combined[hour] = combine(combined[hour], count)
+		}
+		c.ByHour[date] = combined
+	}
+
+	for year, count := range other.RestrictedByYear {
+		if c.RestrictedByYear == nil {
+			c.RestrictedByYear = make(map[int]int)
+		}
+
+		c.RestrictedByYear[year] = combine(c.RestrictedByYear[year], count)
+	}
+
+	for date, count := range other.Restricted {
+		if c.Restricted == nil {
+			c.Restricted = make(map[string]int)
+		}
+
+		c.Restricted[date] = combine(c.Restricted[date], count)
+	}
+}
+
+// DayChange is the change in the count of a day between two contributions
+type DayChange struct {
+	Date   string `json:"date"`
+	Old    int    `json:"old"`
+	New    int    `json:"new"`
+	Change int    `json:"change"`
+}
+
+// ContributionsDiff is the difference between two contributions
+type ContributionsDiff struct {
+	OldTotal     int    `json:"old_total"`
+	NewTotal     int    `json:"new_total"`
+	OldFirstDate string `json:"old_first_date"`
+	OldLastDate  string `json:"old_last_date"`
+	NewFirstDate string `json:"new_first_date"`
+	NewLastDate  string `json:"new_last_date"`
+	// Days is the days whose counts changed, in order.  A day that is only in
+	// one of the contributions has a count of 0 in the other.
+	Days []DayChange `json:"days"`
+}
+
+// DiffContributions returns the days whose counts changed from before to after
+func DiffContributions(before, after *Contributions) *ContributionsDiff {
+	diff := &ContributionsDiff{
+		OldTotal:     before.TotalContributions,
+		NewTotal:     after.TotalContributions,
+		OldFirstDate: before.FirstDate,
+		OldLastDate:  before.LastDate,
+		NewFirstDate: after.FirstDate,
+		NewLastDate:  after.LastDate,
+		Days:         []DayChange{},
+	}
+
+	dates := map[string]bool{}
+	for date := range before.ByDate {
+		dates[date] = true
+	}
+
+	for date := range after.ByDate {
+		dates[date] = true
+	}
+
+	for _, date := range sortedKeys(dates) {
+		if before.ByDate[date] != after.ByDate[date] {
+			diff.Days = append(diff.Days, DayChange{
+				Date:   date,
+				Old:    before.ByDate[date],
+				New:    after.ByDate[date],
+				Change: after.ByDate[date] - before.ByDate[date],
+			})
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,174 @@
+package skyline
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func newTestContributions(username, timezone string, byDate map[string]int) *Contributions {
+	c := &Contributions{Username: username, Timezone: timezone, ByDate: byDate}
+	c.Recompute()
+
+	return c
+}
+
+func TestMergeContributions(t *testing.T) {
+	// older was snapshotted on 2024-01-02, newer on 2024-01-03 and counts
+	// 2024-01-02 differently
+	older := func() *Contributions {
+		c := newTestContributions("someuser", "UTC", map[string]int{"2024-01-01": 4, "2024-01-02": 3})
+		c.ByType = map[ContributionType]map[string]int{ContributionTypeCommits: {"2024-01-01": 1, "2024-01-02": 3}}
+		c.RestrictedByYear = map[int]int{2024: 3}
+		c.Restricted = map[string]int{"2024-01-01": 3}
+		return c
+	}
+
+	newer := func() *Contributions {
+		c := newTestContributions("someuser", "UTC", map[string]int{"2024-01-02": 1, "2024-01-03": 2})
+		c.ByType = map[ContributionType]map[string]int{ContributionTypeIssues: {"2024-01-03": 1}}
+		c.Restricted = map[string]int{"2024-01-03": 1}
+		return c
+	}
+
+	tests := []struct {
+		strategy       MergeStrategy
+		wantByDate     map[string]int
+		wantCommits    map[string]int
+		wantIssues     map[string]int
+		wantRestricted map[string]int
+		wantByYear     map[int]int
+	}{
+		{
+			strategy:       MergeSum,
+			wantByDate:     map[string]int{"2024-01-01": 4, "2024-01-02": 4, "2024-01-03": 2},
+			wantCommits:    map[string]int{"2024-01-01": 1, "2024-01-02": 3},
+			wantIssues:     map[string]int{"2024-01-03": 1},
+			wantRestricted: map[string]int{"2024-01-01": 3, "2024-01-03": 1},
+			wantByYear:     map[int]int{2024: 3},
+		},
+		{
+			strategy:       MergeMax,
+			wantByDate:     map[string]int{"2024-01-01": 4, "2024-01-02": 3, "2024-01-03": 2},
+			wantCommits:    map[string]int{"2024-01-01": 1, "2024-01-02": 3},
+			wantIssues:     map[string]int{"2024-01-03": 1},
+			wantRestricted: map[string]int{"2024-01-01": 3, "2024-01-03": 1},
+			wantByYear:     map[int]int{2024: 3},
+		},
+		{
+			// The newer snapshot replaces everything for the dates it has,
+			// including the types it no longer has on 2024-01-02
+			strategy:       MergeNewest,
+			wantByDate:     map[string]int{"2024-01-01": 4, "2024-01-02": 1, "2024-01-03": 2},
+			wantCommits:    map[string]int{"2024-01-01": 1},
+			wantIssues:     map[string]int{"2024-01-03": 1},
+			wantRestricted: map[string]int{"2024-01-01": 3, "2024-01-03": 1},
+			wantByYear:     map[int]int{2024: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			// The order of the files only matters for newest, which orders
+			// them by their last date itself
+			merged, err := MergeContributions(tt.strategy, newer(), older())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, check := range []struct {
+				field     string
+				got, want map[string]int
+			}{
+				{"by_date", merged.ByDate, tt.wantByDate},
+				{"commits", merged.ByType[ContributionTypeCommits], tt.wantCommits},
+				{"issues", merged.ByType[ContributionTypeIssues], tt.wantIssues},
+				{"restricted", merged.Restricted, tt.wantRestricted},
+			} {
+				if !maps.Equal(check.got, check.want) {
+					t.Errorf("got %s %v, want %v", check.field, check.got, check.want)
+				}
+			}
+
+			if !maps.Equal(merged.RestrictedByYear, tt.wantByYear) {
+				t.Errorf("got restricted by year %v, want %v", merged.RestrictedByYear, tt.wantByYear)
+			}
+
+			if merged.Username != "someuser" || merged.Timezone != "UTC" || merged.FirstDate != "2024-01-01" || merged.LastDate != "2024-01-03" {
+				t.Errorf("got %s in %s between %s and %s", merged.Username, merged.Timezone, merged.FirstDate, merged.LastDate)
+			}
+
+			if err := merged.Validate(); err != nil {
+				t.Errorf("merged contributions are invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestMergeContributionsNewestRestrictedYear(t *testing.T) {
+	older := newTestContributions("someuser", "UTC", map[string]int{"2023-06-01": 2, "2024-01-01": 4})
+	older.RestrictedByYear = map[int]int{2023: 2, 2024: 3}
+	older.Restricted = map[string]int{"2023-06-01": 2, "2024-01-01": 3}
+
+	newer := newTestContributions("someuser", "UTC", map[string]int{"2024-01-01": 5, "2024-01-02": 1})
+	newer.RestrictedByYear = map[int]int{2024: 1}
+	newer.Restricted = map[string]int{"2024-01-02": 1}
+
+	merged, err := MergeContributions(MergeNewest, older, newer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The estimate for 2024 is replaced along with its count, and 2023's is kept
+	if want := map[int]int{2023: 2, 2024: 1}; !maps.Equal(merged.RestrictedByYear, want) {
+		t.Errorf("got restricted by year %v, want %v", merged.RestrictedByYear, want)
+	}
+
+	if want := map[string]int{"2023-06-01": 2, "2024-01-02": 1}; !maps.Equal(merged.Restricted, want) {
+		t.Errorf("got restricted %v, want %v", merged.Restricted, want)
+	}
+}
+
+func TestMergeContributionsErrors(t *testing.T) {
+	utc := newTestContributions("someuser", "UTC", map[string]int{"2024-01-01": 1})
+	berlin := newTestContributions("someuser", "Europe/Berlin", map[string]int{"2024-01-01": 1})
+
+	if _, err := MergeContributions(MergeSum, utc, berlin); err == nil {
+		t.Errorf("merged contributions in different timezones")
+	}
+
+	if _, err := MergeContributions("average", utc, utc); err == nil {
+		t.Errorf("merged with an invalid strategy")
+	}
+
+	if _, err := MergeContributions(MergeSum); err == nil {
+		t.Errorf("merged nothing")
+	}
+
+	// Overlapping files of one account keep the larger estimate with max
+	first := newTestContributions("someuser", "UTC", map[string]int{"2024-01-01": 3})
+	first.Restricted = map[string]int{"2024-01-01": 2}
+	second := newTestContributions("someuser", "UTC", map[string]int{"2024-01-01": 3})
+	second.Restricted = map[string]int{"2024-01-01": 2}
+
+	merged, err := MergeContributions(MergeMax, first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if merged.Restricted["2024-01-01"] != 2 {
+		t.Errorf("got %d restricted, want 2", merged.Restricted["2024-01-01"])
+	}
+
+	// A file with more restricted contributions than contributions on a day
+	// is caught after merging
+	invalid := newTestContributions("someuser", "UTC", map[string]int{"2024-01-01": 1})
+	invalid.Restricted = map[string]int{"2024-01-01": 4}
+
+	_, err = MergeContributions(MergeSum, first, invalid)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.File != "the merged contributions" {
+		t.Errorf("got error %v, want the merged contributions to be invalid", err)
+	}
+}
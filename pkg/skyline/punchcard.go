@@ -0,0 +1,70 @@
+package skyline
+
+import (
+	"fmt"
+	"time"
+)
+
+// Punchcard is the number of commits by weekday (Sunday first) and hour of day
+type Punchcard [7][24]int
+
+// Max returns the highest count in the punchcard
+func (pc Punchcard) Max() int {
+	max := 0
+	for _, hours := range pc {
+		for _, count := range hours {
+			if count > max {
+				max = count
+			}
+		}
+	}
+
+	return max
+}
+
+// Total returns the sum of all counts in the punchcard
+func (pc Punchcard) Total() int {
+	total := 0
+	for _, hours := range pc {
+		for _, count := range hours {
+			total += count
+		}
+	}
+
+	return total
+}
+
+// AddCommitTime counts a commit in ByHour at the hour of its timestamp, in
+// the timezone of the timestamp
+func (c *Contributions) AddCommitTime(t time.Time) {
+	if c.ByHour == nil {
+		c.ByHour = make(map[string][24]int)
+	}
+
+	date := t.Format("2006-01-02")
+	hours := c.ByHour[date]
+	hours[t.Hour()]++
+	c.ByHour[date] = hours
+}
+
+// Punchcard sums the commits in ByHour by weekday and hour
+func (c *Contributions) Punchcard() (Punchcard, error) {
+	var pc Punchcard
+
+	if len(c.ByHour) == 0 {
+		return pc, fmt.Errorf("contributions have no commit times; fetch them again with commit times enabled")
+	}
+
+	for date, hours := range c.ByHour {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return pc, err
+		}
+
+		for hour, count := range hours {
+			pc[t.Weekday()][hour] += count
+		}
+	}
+
+	return pc, nil
+}
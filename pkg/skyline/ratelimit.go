@@ -0,0 +1,281 @@
+package skyline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minSecondaryRateLimitWait is how long to wait after a secondary rate limit
+	// response that doesn't tell us how long to wait, as recommended by GitHub
+	minSecondaryRateLimitWait = time.Minute
+)
+
+// RetryPolicy controls how failed GitHub API requests are retried
+type RetryPolicy struct {
+	// MaxRetries is the number of times a request is retried before giving up
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry, doubled on each attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff delay (rate limit resets are not capped)
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
+// RateLimit is the state of the GitHub API rate limit as last reported by GitHub
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Used      int
+	Cost      int
+	ResetAt   time.Time
+}
+
+func (rl RateLimit) String() string {
+	if rl.Limit == 0 {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("%d/%d remaining, resets at %v", rl.Remaining, rl.Limit, rl.ResetAt.Format(time.TimeOnly))
+}
+
+// retryRoundTripper retries requests that fail with transient errors, and
+// waits for the rate limit to reset when GitHub tells us we have exceeded it
+type retryRoundTripper struct {
+	policy       RetryPolicy
+	roundTripper http.RoundTripper
+	sleep        func(context.Context, time.Duration) error
+	now          func() time.Time
+
+	mu        sync.Mutex
+	rateLimit RateLimit
+}
+
+func newRetryRoundTripper(policy RetryPolicy, roundTripper http.RoundTripper) *retryRoundTripper {
+	return &retryRoundTripper{
+		policy:       policy,
+		roundTripper: roundTripper,
+		sleep:        sleepContext,
+		now:          time.Now,
+	}
+}
+
+// RateLimit returns the last rate limit reported in the response headers
+func (rrt *retryRoundTripper) RateLimit() RateLimit {
+	rrt.mu.Lock()
+	defer rrt.mu.Unlock()
+
+	return rrt.rateLimit
+}
+
+func (rrt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	getBody := req.GetBody
+	if getBody == nil && req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	backoff := rrt.policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		if getBody != nil {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := rrt.roundTripper.RoundTrip(req)
+		if err != nil && req.Context().Err() != nil {
+			return nil, err
+		}
+
+		wait, reason, resp := rrt.checkResponse(resp, err)
+		if reason == "" || attempt > rrt.policy.MaxRetries {
+			if err == nil {
+				err = rrt.responseError(resp, reason)
+			}
+
+			if err != nil && resp != nil {
+				resp.Body.Close()
+				resp = nil
+			}
+
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if wait < backoff {
+			wait = backoff
+		}
+
+		fmt.Printf("%s, retrying in %v (attempt %d/%d)\n", reason, wait.Round(time.Second), attempt, rrt.policy.MaxRetries)
+
+		if err := rrt.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+
+		backoff *= 2
+		if backoff > rrt.policy.MaxBackoff {
+			backoff = rrt.policy.MaxBackoff
+		}
+	}
+}
+
+// checkResponse records the rate limit headers and decides if the request
+// should be retried.  If so, it returns the minimum time to wait and the
+// reason for the retry.  The response body is preserved for the caller.
+func (rrt *retryRoundTripper) checkResponse(resp *http.Response, err error) (time.Duration, string, *http.Response) {
+	if err != nil {
+		return 0, fmt.Sprintf("Request failed: %v", err), resp
+	}
+
+	rrt.updateRateLimit(resp.Header)
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return 0, fmt.Sprintf("GitHub API returned %v", resp.Status), resp
+
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if wait, ok := rrt.rateLimitWait(resp.Header); ok {
+			return wait, "GitHub API rate limit exceeded", resp
+		}
+
+		body, resp := peekBody(resp)
+		if strings.Contains(strings.ToLower(body), "rate limit") {
+			return minSecondaryRateLimitWait, "GitHub API secondary rate limit exceeded", resp
+		}
+
+		return 0, "", resp
+
+	case http.StatusOK:
+		// GraphQL reports an exhausted primary rate limit as a RATE_LIMITED error
+		if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+			return 0, "", resp
+		}
+
+		body, resp := peekBody(resp)
+		if strings.Contains(body, "RATE_LIMITED") {
+			wait, _ := rrt.rateLimitWait(resp.Header)
+			return wait, "GitHub API rate limit exceeded", resp
+		}
+
+		return 0, "", resp
+	}
+
+	return 0, "", resp
+}
+
+// responseError returns the typed error for a response that failed for good:
+// rejected credentials, or a rate limit that is still exceeded after retrying
+func (rrt *retryRoundTripper) responseError(resp *http.Response, reason string) error {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return &BadCredentialsError{Status: resp.Status}
+	}
+
+	if !strings.Contains(reason, "rate limit") {
+		return nil
+	}
+
+	rateLimit := &RateLimitError{}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rateLimit.ResetAt = time.Unix(reset, 0)
+	} else if wait, ok := rrt.rateLimitWait(resp.Header); ok {
+		rateLimit.ResetAt = rrt.now().Add(wait)
+	}
+
+	return rateLimit
+}
+
+// rateLimitWait returns how long GitHub asked us to wait, either through the
+// Retry-After header or an exhausted rate limit with a reset time
+func (rrt *retryRoundTripper) rateLimitWait(header http.Header) (time.Duration, bool) {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		seconds, err := strconv.Atoi(retryAfter)
+		if err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return minSecondaryRateLimitWait, true
+	}
+
+	wait := time.Unix(reset, 0).Sub(rrt.now())
+	if wait < 0 {
+		wait = 0
+	}
+
+	// Add a second to make sure the reset has happened on GitHub's side
+	return wait + time.Second, true
+}
+
+func (rrt *retryRoundTripper) updateRateLimit(header http.Header) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+
+	rrt.mu.Lock()
+	defer rrt.mu.Unlock()
+
+	rrt.rateLimit.Limit = limit
+	rrt.rateLimit.Remaining, _ = strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	rrt.rateLimit.Used, _ = strconv.Atoi(header.Get("X-RateLimit-Used"))
+
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rrt.rateLimit.ResetAt = time.Unix(reset, 0)
+	}
+}
+
+// peekBody reads the response body and replaces it so it can be read again
+func peekBody(resp *http.Response) (string, *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", resp
+	}
+
+	return string(body), resp
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
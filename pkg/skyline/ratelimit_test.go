@@ -0,0 +1,341 @@
+package skyline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const fakeGraphQLData = `{"data":{"viewer":{"login":"someuser"}}}`
+
+// fakeGraphQLServer answers each request with the next of the responses,
+// repeating the last one once they run out
+type fakeGraphQLServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []func(w http.ResponseWriter)
+	bodies    []string
+}
+
+func newFakeGraphQLServer(t *testing.T, responses ...func(w http.ResponseWriter)) *fakeGraphQLServer {
+	fs := &fakeGraphQLServer{responses: responses}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		fs.mu.Lock()
+		fs.bodies = append(fs.bodies, string(body))
+		respond := fs.responses[min(len(fs.bodies), len(fs.responses))-1]
+		fs.mu.Unlock()
+
+		respond(w)
+	}))
+	t.Cleanup(fs.Close)
+
+	return fs
+}
+
+func (fs *fakeGraphQLServer) requests() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return append([]string{}, fs.bodies...)
+}
+
+func respond(status int, body string, headers ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}
+}
+
+// newTestRetryRoundTripper returns a retryRoundTripper that records its waits
+// instead of sleeping, with the clock fixed at now
+func newTestRetryRoundTripper(policy RetryPolicy, now time.Time) (*retryRoundTripper, *[]time.Duration) {
+	waits := &[]time.Duration{}
+
+	rrt := newRetryRoundTripper(policy, http.DefaultTransport)
+	rrt.now = func() time.Time { return now }
+	rrt.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+
+	return rrt, waits
+}
+
+func postQuery(t *testing.T, rrt *retryRoundTripper, url string) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"query":"{viewer{login}}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: rrt}
+	return client.Do(req)
+}
+
+var testRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     4 * time.Second,
+}
+
+func TestRetryBadGatewayThenSuccess(t *testing.T) {
+	server := newFakeGraphQLServer(t,
+		respond(http.StatusBadGateway, "Bad Gateway"),
+		respond(http.StatusBadGateway, "Bad Gateway"),
+		respond(http.StatusOK, fakeGraphQLData),
+	)
+
+	rrt, waits := newTestRetryRoundTripper(testRetryPolicy, time.Now())
+
+	resp, err := postQuery(t, rrt, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != fakeGraphQLData {
+		t.Errorf("got %d %q, want 200 %q", resp.StatusCode, body, fakeGraphQLData)
+	}
+
+	requests := server.requests()
+	if len(requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(requests))
+	}
+
+	// The body must be sent again on every retry
+	for i, body := range requests {
+		if body != requests[0] || body == "" {
+			t.Errorf("request %d has body %q, want %q", i+1, body, requests[0])
+		}
+	}
+
+	if want := []time.Duration{time.Second, 2 * time.Second}; fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("waited %v, want exponential backoff %v", *waits, want)
+	}
+}
+
+func TestRetrySecondaryRateLimitRetryAfter(t *testing.T) {
+	server := newFakeGraphQLServer(t,
+		respond(http.StatusForbidden, `{"message":"You have exceeded a secondary rate limit"}`, "Retry-After", "30"),
+		respond(http.StatusOK, fakeGraphQLData),
+	)
+
+	rrt, waits := newTestRetryRoundTripper(testRetryPolicy, time.Now())
+
+	resp, err := postQuery(t, rrt, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want 200", resp.StatusCode)
+	}
+
+	// Retry-After is longer than the backoff, and isn't capped by MaxBackoff
+	if want := []time.Duration{30 * time.Second}; fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("waited %v, want %v", *waits, want)
+	}
+}
+
+func TestRetrySecondaryRateLimitWithoutRetryAfter(t *testing.T) {
+	server := newFakeGraphQLServer(t,
+		respond(http.StatusForbidden, `{"message":"You have exceeded a secondary rate limit"}`),
+		respond(http.StatusOK, fakeGraphQLData),
+	)
+
+	rrt, waits := newTestRetryRoundTripper(testRetryPolicy, time.Now())
+
+	resp, err := postQuery(t, rrt, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if want := []time.Duration{minSecondaryRateLimitWait}; fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("waited %v, want %v", *waits, want)
+	}
+}
+
+func TestRetryPrimaryRateLimitWaitsForReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reset := now.Add(90 * time.Second)
+
+	server := newFakeGraphQLServer(t,
+		respond(http.StatusOK, `{"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded"}]}`,
+			"X-RateLimit-Limit", "5000",
+			"X-RateLimit-Remaining", "0",
+			"X-RateLimit-Used", "5000",
+			"X-RateLimit-Reset", fmt.Sprint(reset.Unix()),
+		),
+		respond(http.StatusOK, fakeGraphQLData,
+			"X-RateLimit-Limit", "5000",
+			"X-RateLimit-Remaining", "4999",
+			"X-RateLimit-Used", "1",
+			"X-RateLimit-Reset", fmt.Sprint(reset.Add(time.Hour).Unix()),
+		),
+	)
+
+	rrt, waits := newTestRetryRoundTripper(testRetryPolicy, now)
+
+	resp, err := postQuery(t, rrt, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	// The wait until the reset, plus a second, isn't capped by MaxBackoff
+	if want := []time.Duration{91 * time.Second}; fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("waited %v, want %v", *waits, want)
+	}
+
+	rateLimit := rrt.RateLimit()
+	if rateLimit.Remaining != 4999 || rateLimit.Limit != 5000 || rateLimit.Used != 1 {
+		t.Errorf("got rate limit %+v, want the one from the last response", rateLimit)
+	}
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	server := newFakeGraphQLServer(t, respond(http.StatusBadGateway, "Bad Gateway"))
+
+	rrt, waits := newTestRetryRoundTripper(testRetryPolicy, time.Now())
+
+	resp, err := postQuery(t, rrt, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("got status %d, want the last 502", resp.StatusCode)
+	}
+
+	if got, want := len(server.requests()), testRetryPolicy.MaxRetries+1; got != want {
+		t.Errorf("got %d requests, want %d", got, want)
+	}
+
+	// The backoff doubles up to MaxBackoff
+	if want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("waited %v, want %v", *waits, want)
+	}
+}
+
+func TestRetryGivesUpOnRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reset := now.Add(time.Hour)
+
+	server := newFakeGraphQLServer(t, respond(http.StatusForbidden, `{"message":"API rate limit exceeded"}`,
+		"X-RateLimit-Limit", "5000",
+		"X-RateLimit-Remaining", "0",
+		"X-RateLimit-Reset", fmt.Sprint(reset.Unix()),
+	))
+
+	rrt, _ := newTestRetryRoundTripper(testRetryPolicy, now)
+
+	_, err := postQuery(t, rrt, server.URL)
+
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("got error %v, want a RateLimitError", err)
+	}
+
+	if !rateLimitErr.ResetAt.Equal(reset) {
+		t.Errorf("got reset at %v, want %v", rateLimitErr.ResetAt, reset)
+	}
+
+	if got, want := len(server.requests()), testRetryPolicy.MaxRetries+1; got != want {
+		t.Errorf("got %d requests, want %d", got, want)
+	}
+}
+
+func TestRetryDoesNotRetryOtherErrors(t *testing.T) {
+	server := newFakeGraphQLServer(t, respond(http.StatusUnauthorized, `{"message":"Bad credentials"}`))
+
+	rrt, waits := newTestRetryRoundTripper(testRetryPolicy, time.Now())
+
+	_, err := postQuery(t, rrt, server.URL)
+
+	var badCredentials *BadCredentialsError
+	if !errors.As(err, &badCredentials) {
+		t.Fatalf("got error %v, want a BadCredentialsError", err)
+	}
+
+	if len(server.requests()) != 1 || len(*waits) != 0 {
+		t.Errorf("got %d requests and waits %v, want 1 request without retries", len(server.requests()), *waits)
+	}
+}
+
+func TestFetcherWaitsForRateLimitReset(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	reset := now.Add(90 * time.Second)
+
+	year := func(year, remaining int, resetAt time.Time) func(w http.ResponseWriter) {
+		return respond(http.StatusOK, fmt.Sprintf(`{"data":{
+			"rateLimit":{"cost":1,"limit":5000,"remaining":%d,"used":%d,"resetAt":%q},
+			"user":{"contributionsCollection":{"restrictedContributionsCount":0,"contributionCalendar":{
+				"totalContributions":1,
+				"weeks":[{"contributionDays":[{"contributionCount":1,"date":"%d-05-01"}]}]
+			}}}
+		}}`, remaining, 5000-remaining, resetAt.Format(time.RFC3339), year))
+	}
+
+	server := newFakeGraphQLServer(t,
+		respond(http.StatusOK, `{"data":{"user":{"createdAt":"2020-01-01T00:00:00Z","contributionsCollection":{"contributionYears":[2024,2023]}}}}`),
+		// The first year uses up the rate limit, so the second one waits for
+		// it to reset
+		year(2023, 0, reset),
+		year(2024, 4999, reset.Add(time.Hour)),
+	)
+
+	fetcher := NewGitHubContributionsFetcher("someuser", "test-token",
+		WithAPIURL(server.URL+"/graphql"),
+		WithParallelism(1),
+		WithLocation(time.UTC),
+	)
+
+	waits := []time.Duration{}
+	fetcher.transport.now = func() time.Time { return now }
+	fetcher.transport.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	contribs, err := fetcher.FetchContributions(0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contribs.TotalContributions != 2 {
+		t.Errorf("got %d contributions, want 2", contribs.TotalContributions)
+	}
+
+	if len(server.requests()) != 3 {
+		t.Errorf("got %d requests, want 3", len(server.requests()))
+	}
+
+	// It waits until a second after the reset, before the query for 2024
+	if want := []time.Duration{91 * time.Second}; fmt.Sprint(waits) != fmt.Sprint(want) {
+		t.Errorf("waited %v, want %v", waits, want)
+	}
+
+	if rateLimit := fetcher.RateLimit(); rateLimit.Remaining != 4999 {
+		t.Errorf("got rate limit %+v, want the one after the reset", rateLimit)
+	}
+}
@@ -0,0 +1,161 @@
+package skyline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSource("repo", newRepositorySource)
+}
+
+// remoteRepositoryPattern matches the owner/name at the end of a remote URL,
+// like git@github.com:owner/name.git or https://github.com/owner/name
+var remoteRepositoryPattern = regexp.MustCompile(`[:/]([^/:]+/[^/]+?)(\.git)?/?$`)
+
+// FetchRepositoryContributions fetches the commits to the default branch of a
+// repository by all authors between startYear and endYear (inclusive), and
+// counts them by day in the given location.  A year of 0 leaves that end of
+// the range open.
+func (gcf *GitHubContributionsFetcher) FetchRepositoryContributions(owner, name string, startYear, endYear int, location *time.Location) (*Contributions, error) {
+	if location == nil {
+		location = time.Local
+	}
+
+	var since, until *GitTimestamp
+	if startYear != 0 {
+		since = &GitTimestamp{time.Date(startYear, 1, 1, 0, 0, 0, 0, location)}
+	}
+
+	if endYear != 0 {
+		until = &GitTimestamp{time.Date(endYear+1, 1, 1, 0, 0, 0, 0, location).Add(-time.Second)}
+	}
+
+	times, err := gcf.fetchHistory(context.Background(), owner, name, nil, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Fetched %d commits to %s/%s\n", len(times), owner, name)
+
+	contrib := &Contributions{
+		Repository: owner + "/" + name,
+		Timezone:   location.String(),
+		ByDate:     make(map[string]int),
+	}
+
+	for _, t := range times {
+		contrib.ByDate[t.In(location).Format("2006-01-02")]++
+		contrib.AddCommitTime(t)
+	}
+
+	contrib.Recompute()
+
+	return contrib, nil
+}
+
+// repositorySource counts the commits to a repository by all of its authors,
+// from the GitHub API or from a local clone
+type repositorySource struct {
+	repository string
+	owner      string
+	name       string
+	fetcher    *GitHubContributionsFetcher
+	local      *LocalGitSource
+	location   *time.Location
+}
+
+// newRepositorySource creates the repo source for the repository in the path,
+// which is either owner/name on GitHub or the path of a local clone, with the
+// "name", "branch", "timezone" and "git" options.  The name labels the skyline,
+// and for a local clone defaults to the owner/name of its origin remote.
+func newRepositorySource(config SourceConfig) (ContributionsSource, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("the repo source requires a repository, like owner/name, or the path of a local clone")
+	}
+
+	loc, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &repositorySource{
+		repository: config.Option("name", ""),
+		location:   loc,
+	}
+
+	if info, err := os.Stat(config.Path); err == nil && info.IsDir() {
+		rs.local = NewLocalGitSource("", []string{config.Path}, nil, loc)
+		rs.local.Revision = config.Option("branch", "HEAD")
+		rs.local.GitPath = config.Option("git", rs.local.GitPath)
+
+		if rs.repository == "" {
+			rs.repository = rs.localRepositoryName(config.Path)
+		}
+
+		return rs, nil
+	}
+
+	owner, name, ok := strings.Cut(strings.Trim(config.Path, "/"), "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid repository: %s; must be owner/name or the path of a local clone", config.Path)
+	}
+
+	rs.owner, rs.name = owner, name
+	if rs.repository == "" {
+		rs.repository = owner + "/" + name
+	}
+
+	opts := config.GitHubOptions
+	if config.URL != "" {
+		opts = append(opts, WithAPIURL(config.URL))
+	}
+
+	rs.fetcher = NewGitHubContributionsFetcher("", config.Token, opts...)
+
+	return rs, nil
+}
+
+func (rs *repositorySource) FetchContributions(startYear, endYear int) (*Contributions, error) {
+	var contrib *Contributions
+	var err error
+
+	if rs.local != nil {
+		contrib, err = rs.local.FetchContributions(startYear, endYear)
+	} else {
+		contrib, err = rs.fetcher.FetchRepositoryContributions(rs.owner, rs.name, startYear, endYear, rs.location)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	contrib.Username = ""
+	contrib.Repository = rs.repository
+
+	return contrib, nil
+}
+
+// localRepositoryName returns the owner/name of the origin remote of a local
+// clone, or the name of its directory if it has no such remote
+func (rs *repositorySource) localRepositoryName(dir string) string {
+	out, err := exec.Command(rs.local.GitPath, "-C", dir, "remote", "get-url", "origin").Output()
+	if err == nil {
+		if match := remoteRepositoryPattern.FindSubmatch(bytes.TrimSpace(out)); match != nil {
+			return string(match[1])
+		}
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	return filepath.Base(dir)
+}
@@ -0,0 +1,93 @@
+package skyline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// PrivateModeAdd adds restricted contributions to the building heights
+	PrivateModeAdd = PrivateMode("add")
+	// PrivateModeLayer shows restricted contributions as a separate layer on
+	// top of each building
+	PrivateModeLayer = PrivateMode("layer")
+)
+
+// PrivateMode is how restricted (private) contributions are shown in a skyline
+type PrivateMode string
+
+// ParsePrivateMode parses the name of a PrivateMode
+func ParsePrivateMode(mode string) (PrivateMode, error) {
+	switch pm := PrivateMode(strings.ToLower(mode)); pm {
+	case PrivateModeAdd, PrivateModeLayer:
+		return pm, nil
+	}
+
+	return "", fmt.Errorf("invalid private mode: %s; must be add or layer", mode)
+}
+
+// RestrictedContributions returns the number of restricted contributions, which
+// are contributions to private repositories that the token can't see.  They
+// are counted in ByDate, and by year in RestrictedByYear.  Restricted has an
+// estimate of them by date if the per-type breakdown was fetched.
+func (c *Contributions) RestrictedContributions() int {
+	total := 0
+	for _, count := range c.RestrictedByYear {
+		total += count
+	}
+
+	return total
+}
+
+// PublicContributions returns the number of contributions that aren't restricted
+func (c *Contributions) PublicContributions() int {
+	return c.TotalContributions - c.RestrictedContributions()
+}
+
+// attributeRestricted estimates the restricted contributions on each day of a
+// year as the part of the calendar count that the per-type breakdown doesn't
+// account for, up to the restricted count for the year.  This requires the
+// breakdown.  The calendar counts are on GitHub's days while the breakdown is
+// bucketed in the contributions' timezone, so contributions near midnight can
+// move the estimate to the day before or after.
+func (c *Contributions) attributeRestricted(year int) {
+	remaining := c.RestrictedByYear[year]
+	if remaining == 0 || len(c.ByType) == 0 {
+		return
+	}
+
+	prefix := fmt.Sprintf("%d-", year)
+
+	dates := []string{}
+	for date := range c.ByDate {
+		if strings.HasPrefix(date, prefix) {
+			dates = append(dates, date)
+		}
+	}
+
+	sort.Strings(dates)
+
+	for _, date := range dates {
+		public := 0
+		for _, byDate := range c.ByType {
+			public += byDate[date]
+		}
+
+		restricted := min(c.ByDate[date]-public, remaining)
+		if restricted <= 0 {
+			continue
+		}
+
+		if c.Restricted == nil {
+			c.Restricted = make(map[string]int)
+		}
+
+		c.Restricted[date] = restricted
+		remaining -= restricted
+
+		if remaining == 0 {
+			return
+		}
+	}
+}
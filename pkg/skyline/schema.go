@@ -0,0 +1,460 @@
+package skyline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the contributions file format written by
+// SaveToFile.  Files from before the version was added are version 1.
+const SchemaVersion = 2
+
+// migrations upgrade the top level fields of a contributions file by one
+// version, the first one from version 1 to 2
+var migrations = []func(fields map[string]json.RawMessage) error{
+	// Version 2 only adds schema_version, which is set after migrating
+	func(fields map[string]json.RawMessage) error { return nil },
+}
+
+// Problem is something wrong with a contributions file
+type Problem struct {
+	// Line is the line of the file the problem is on, or 0 if it isn't known
+	Line int
+	// Path is the keys leading to the problem, like by_date/2024-01-31
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// ValidationError lists every problem found in contributions
+type ValidationError struct {
+	// File is the contributions file, if they were loaded from one
+	File     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	what := "contributions"
+	if e.File != "" {
+		what = e.File
+	}
+
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("%s has %d problem(s):", what, len(e.Problems)))
+	for _, problem := range e.Problems {
+		lines = append(lines, "  "+problem.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks that the dates are valid, the counts are not negative, and
+// the total, first and last date match the counts by date.  Team members are
+// checked too.  The error is a *ValidationError with every problem found.
+func (c *Contributions) Validate() error {
+	problems := c.validate("")
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Problems: problems}
+}
+
+func (c *Contributions) validate(prefix string) []Problem {
+	problems := []Problem{}
+	add := func(path, format string, args ...any) {
+		problems = append(problems, Problem{Path: prefix + path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	checkCounts := func(path, field string, counts map[string]int) {
+		for _, date := range sortedKeys(counts) {
+			if !validDate(date) {
+				add(path+"/"+date, "%s: invalid date %q, must be YYYY-MM-DD", field, date)
+			}
+
+			if counts[date] < 0 {
+				add(path+"/"+date, "%s: negative count %d on %s", field, counts[date], date)
+			}
+		}
+	}
+
+	checkCounts("by_date", "by_date", c.ByDate)
+
+	for _, contribType := range sortedKeys(c.ByType) {
+		path := "by_type/" + string(contribType)
+		if !slices.Contains(ContributionTypes, contribType) {
+			add(path, "by_type: unknown contribution type %q; must be one of %v", contribType, ContributionTypes)
+		}
+
+		checkCounts(path, fmt.Sprintf("by_type %s", contribType), c.ByType[contribType])
+	}
+
+	for _, date := range sortedKeys(c.ByHour) {
+		path := "by_hour/" + date
+		if !validDate(date) {
+			add(path, "by_hour: invalid date %q, must be YYYY-MM-DD", date)
+		}
+
+		for hour, count := range c.ByHour[date] {
+			if count < 0 {
+				add(path, "by_hour: negative count %d at %02d:00 on %s", count, hour, date)
+			}
+		}
+	}
+
+	checkCounts("restricted", "restricted", c.Restricted)
+	for _, date := range sortedKeys(c.Restricted) {
+		if c.Restricted[date] > c.ByDate[date] {
+			add("restricted/"+date, "restricted: %d restricted contributions on %s, but only %d in total", c.Restricted[date], date, c.ByDate[date])
+		}
+	}
+
+	for _, year := range sortedKeys(c.RestrictedByYear) {
+		if c.RestrictedByYear[year] < 0 {
+			add(fmt.Sprintf("restricted_by_year/%d", year), "restricted_by_year: negative count %d in %d", c.RestrictedByYear[year], year)
+		}
+	}
+
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			add("timezone", "timezone: %v", err)
+		}
+	}
+
+	// The totals are recomputed from the valid dates only, so a bad date is
+	// reported once instead of again as a wrong total
+	total := 0
+	firstDate, lastDate := "", ""
+	for date, count := range c.ByDate {
+		total += count
+
+		if !validDate(date) {
+			continue
+		}
+
+		if firstDate == "" || date < firstDate {
+			firstDate = date
+		}
+
+		if lastDate == "" || date > lastDate {
+			lastDate = date
+		}
+	}
+
+	if c.TotalContributions != total {
+		add("total_contributions", "total_contributions is %d, but the counts in by_date add up to %d", c.TotalContributions, total)
+	}
+
+	for _, field := range []struct {
+		name, value, want string
+	}{
+		{"first_date", c.FirstDate, firstDate},
+		{"last_date", c.LastDate, lastDate},
+	} {
+		switch {
+		case field.value != "" && !validDate(field.value):
+			add(field.name, "%s: invalid date %q, must be YYYY-MM-DD", field.name, field.value)
+		case field.value != field.want:
+			add(field.name, "%s is %q, but the dates in by_date are %s", field.name, field.value, dateRange(firstDate, lastDate))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Members) {
+		member := c.Members[name]
+		if member == nil {
+			add("members/"+name, "members: %s has no contributions", name)
+			continue
+		}
+
+		for _, problem := range member.validate("members/" + name + "/") {
+			problem.Message = fmt.Sprintf("member %s: %s", name, problem.Message)
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems
+}
+
+// decodeContributions migrates and decodes a contributions file, and
+// validates it.  The problems are reported with their line in data.
+func decodeContributions(file string, data []byte) (*Contributions, error) {
+	invalid := func(problems ...Problem) error {
+		lines := jsonKeyLines(data)
+		for i := range problems {
+			if problems[i].Line == 0 {
+				problems[i].Line = lineOfPath(lines, problems[i].Path)
+			}
+		}
+
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+
+		return &ValidationError{File: file, Problems: problems}
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, invalid(decodeProblem(data, err, true))
+	}
+
+	version := 1
+	if raw, ok := fields["schema_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil || version < 1 {
+			return nil, invalid(Problem{Path: "schema_version", Message: fmt.Sprintf("invalid schema_version %s", raw)})
+		}
+	}
+
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("%s has schema version %d, but this version of github-skyline only reads up to version %d; upgrade github-skyline to read it", file, version, SchemaVersion)
+	}
+
+	problems := unknownFields(fields, "")
+	if raw, ok := fields["members"]; ok {
+		members := map[string]map[string]json.RawMessage{}
+		if json.Unmarshal(raw, &members) == nil {
+			for _, name := range sortedKeys(members) {
+				problems = append(problems, unknownFields(members[name], "members/"+name+"/")...)
+			}
+		}
+	}
+
+	decoded := data
+	if version < SchemaVersion {
+		for _, migrate := range migrations[version-1:] {
+			if err := migrate(fields); err != nil {
+				return nil, fmt.Errorf("migrating %s from schema version %d: %w", file, version, err)
+			}
+		}
+
+		var err error
+		decoded, err = json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	contribs := &Contributions{}
+	if err := json.Unmarshal(decoded, contribs); err != nil {
+		// After migrating, the offsets are in the migrated data, not the file
+		return nil, invalid(append(problems, decodeProblem(decoded, err, version == SchemaVersion))...)
+	}
+
+	problems = append(problems, contribs.validate("")...)
+	if len(problems) > 0 {
+		return nil, invalid(problems...)
+	}
+
+	contribs.SchemaVersion = SchemaVersion
+
+	return contribs, nil
+}
+
+// unknownFields reports the keys that aren't fields of Contributions, which
+// are usually typos in a hand-edited file
+func unknownFields(fields map[string]json.RawMessage, prefix string) []Problem {
+	known := map[string]bool{}
+	contribsType := reflect.TypeOf(Contributions{})
+	for i := 0; i < contribsType.NumField(); i++ {
+		name, _, _ := strings.Cut(contribsType.Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+
+	problems := []Problem{}
+	for _, key := range sortedKeys(fields) {
+		if !known[key] {
+			problems = append(problems, Problem{Path: prefix + key, Message: fmt.Sprintf("unknown field %q", key)})
+		}
+	}
+
+	return problems
+}
+
+// decodeProblem turns a JSON error into a problem, on the line it happened on
+// if the offsets in the error are in the file
+func decodeProblem(data []byte, err error, inFile bool) Problem {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	problem := Problem{Message: err.Error()}
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		problem.Message = fmt.Sprintf("invalid JSON: %v", syntaxErr)
+		if inFile {
+			problem.Line = lineAt(data, syntaxErr.Offset)
+		}
+
+	case errors.As(err, &typeErr):
+		problem.Path = strings.ReplaceAll(typeErr.Field, ".", "/")
+		problem.Message = fmt.Sprintf("expected %s, not %s", jsonTypeName(typeErr.Type), typeErr.Value)
+		if typeErr.Field != "" {
+			problem.Message = fmt.Sprintf("%s: %s", typeErr.Field, problem.Message)
+		}
+
+		if inFile {
+			problem.Line = lineAt(data, typeErr.Offset)
+		}
+	}
+
+	return problem
+}
+
+// jsonTypeName describes the JSON value a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Map, reflect.Struct, reflect.Pointer:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	}
+
+	return t.String()
+}
+
+// jsonKeyLines returns the line of every object key in a JSON document, by
+// the path of keys leading to it joined with "/"
+func jsonKeyLines(data []byte) map[string]int {
+	type container struct {
+		path   string
+		object bool
+		key    bool
+		index  int
+	}
+
+	lines := map[string]int{}
+	stack := []*container{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	// valueDone moves the enclosing container on to its next key or element
+	valueDone := func() {
+		if len(stack) == 0 {
+			return
+		}
+
+		top := stack[len(stack)-1]
+		if top.object {
+			top.key = true
+		} else {
+			top.index++
+		}
+	}
+
+	var key string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return lines
+		}
+
+		var top *container
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if top != nil && top.object && top.key {
+			if tok == json.Delim('}') {
+				stack = stack[:len(stack)-1]
+				valueDone()
+				continue
+			}
+
+			key = fmt.Sprint(tok)
+			lines[strings.TrimPrefix(top.path+"/"+key, "/")] = lineAt(data, dec.InputOffset())
+			top.key = false
+			continue
+		}
+
+		path := ""
+		if top != nil && top.object {
+			path = strings.TrimPrefix(top.path+"/"+key, "/")
+		} else if top != nil {
+			path = top.path + "/" + strconv.Itoa(top.index)
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &container{path: path, object: true, key: true})
+		case json.Delim('['):
+			stack = append(stack, &container{path: path})
+		case json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+}
+
+// lineOfPath returns the line of a path, or of the closest enclosing key that
+// is in the file if the path itself isn't
+func lineOfPath(lines map[string]int, path string) int {
+	for path != "" {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+
+	return 0
+}
+
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func validDate(date string) bool {
+	_, err := time.Parse("2006-01-02", date)
+	return err == nil
+}
+
+func dateRange(first, last string) string {
+	if first == "" {
+		return "empty"
+	}
+
+	return fmt.Sprintf("%s to %s", first, last)
+}
+
+// sortedKeys returns the keys of a map in order, so problems are reported in
+// the same order every time
+func sortedKeys[K interface{ ~string | ~int }, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	return keys
+}
@@ -0,0 +1,268 @@
+package skyline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// validContributionsFile is a valid version 2 file; the tests replace parts of
+// it to break it on a known line
+const validContributionsFile = `{
+  "schema_version": 2,
+  "username": "someuser",
+  "timezone": "UTC",
+  "total_contributions": 5,
+  "first_date": "2024-01-01",
+  "last_date": "2024-01-02",
+  "by_date": {
+    "2024-01-01": 3,
+    "2024-01-02": 2
+  },
+  "by_type": {
+    "commits": {
+      "2024-01-01": 1
+    }
+  },
+  "restricted": {
+    "2024-01-02": 1
+  }
+}`
+
+func TestDecodeContributions(t *testing.T) {
+	contribs, err := decodeContributions("contributions.json", []byte(validContributionsFile))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contribs.TotalContributions != 5 || contribs.ByDate["2024-01-01"] != 3 || contribs.ByType[ContributionTypeCommits]["2024-01-01"] != 1 {
+		t.Errorf("got %+v, want the contributions in the file", contribs)
+	}
+}
+
+func TestDecodeContributionsProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		wantLine int
+		want     string
+	}{
+		{
+			name:     "invalid date",
+			old:      `"2024-01-02": 2`,
+			new:      `"2024-01-32": 2`,
+			wantLine: 10,
+			want:     `by_date: invalid date "2024-01-32"`,
+		},
+		{
+			name:     "negative count",
+			old:      `"2024-01-01": 3`,
+			new:      `"2024-01-01": -3`,
+			wantLine: 9,
+			want:     "by_date: negative count -3 on 2024-01-01",
+		},
+		{
+			name:     "wrong total",
+			old:      `"total_contributions": 5`,
+			new:      `"total_contributions": 6`,
+			wantLine: 5,
+			want:     "total_contributions is 6, but the counts in by_date add up to 5",
+		},
+		{
+			name:     "wrong first date",
+			old:      `"first_date": "2024-01-01"`,
+			new:      `"first_date": "2023-12-31"`,
+			wantLine: 6,
+			want:     `first_date is "2023-12-31", but the dates in by_date are 2024-01-01 to 2024-01-02`,
+		},
+		{
+			name:     "wrong last date",
+			old:      `"last_date": "2024-01-02"`,
+			new:      `"last_date": "2024-01-03"`,
+			wantLine: 7,
+			want:     `last_date is "2024-01-03"`,
+		},
+		{
+			name:     "unknown type",
+			old:      `"commits": {`,
+			new:      `"commit": {`,
+			wantLine: 13,
+			want:     `by_type: unknown contribution type "commit"`,
+		},
+		{
+			name:     "more restricted than contributions",
+			old:      `"2024-01-02": 1`,
+			new:      `"2024-01-02": 4`,
+			wantLine: 18,
+			want:     "restricted: 4 restricted contributions on 2024-01-02, but only 2 in total",
+		},
+		{
+			name:     "unknown field",
+			old:      `"timezone": "UTC"`,
+			new:      `"timezon": "UTC"`,
+			wantLine: 4,
+			want:     `unknown field "timezon"`,
+		},
+		{
+			name:     "invalid timezone",
+			old:      `"timezone": "UTC"`,
+			new:      `"timezone": "Mars/Olympus_Mons"`,
+			wantLine: 4,
+			want:     "timezone: unknown time zone Mars/Olympus_Mons",
+		},
+		{
+			name:     "wrong type",
+			old:      `"2024-01-02": 2`,
+			new:      `"2024-01-02": "2"`,
+			wantLine: 10,
+			want:     "expected a number, not string",
+		},
+		{
+			name:     "invalid JSON",
+			old:      `"last_date": "2024-01-02",`,
+			new:      `"last_date": "2024-01-02"`,
+			wantLine: 8,
+			want:     "invalid JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(validContributionsFile, tt.old) {
+				t.Fatalf("%q is not in the file", tt.old)
+			}
+
+			data := strings.Replace(validContributionsFile, tt.old, tt.new, 1)
+
+			_, err := decodeContributions("contributions.json", []byte(data))
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("got error %v, want a ValidationError", err)
+			}
+
+			if invalid.File != "contributions.json" {
+				t.Errorf("got file %q, want contributions.json", invalid.File)
+			}
+
+			for _, problem := range invalid.Problems {
+				if strings.Contains(problem.Message, tt.want) {
+					if problem.Line != tt.wantLine {
+						t.Errorf("got %q on line %d, want line %d", problem.Message, problem.Line, tt.wantLine)
+					}
+					return
+				}
+			}
+
+			t.Errorf("got problems %v, want %q on line %d", invalid.Problems, tt.want, tt.wantLine)
+		})
+	}
+}
+
+func TestDecodeContributionsMemberProblems(t *testing.T) {
+	data := `{
+  "username": "Team",
+  "total_contributions": 1,
+  "first_date": "2024-01-01",
+  "last_date": "2024-01-01",
+  "by_date": {"2024-01-01": 1},
+  "members": {
+    "alice": {
+      "username": "alice",
+      "total_contributions": 2,
+      "first_date": "2024-01-01",
+      "last_date": "2024-01-01",
+      "by_date": {"2024-01-01": 1}
+    }
+  }
+}`
+
+	_, err := decodeContributions("team.json", []byte(data))
+
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 1 {
+		t.Fatalf("got error %v, want one problem", err)
+	}
+
+	problem := invalid.Problems[0]
+	if problem.Line != 10 || !strings.HasPrefix(problem.Message, "member alice: total_contributions is 2") {
+		t.Errorf("got %v, want alice's total on line 10", problem)
+	}
+}
+
+func TestDecodeContributionsMigration(t *testing.T) {
+	// Version 1 files have no schema_version
+	data := strings.Replace(validContributionsFile, `"schema_version": 2,`, "", 1)
+
+	contribs, err := decodeContributions("contributions.json", []byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contribs.SchemaVersion != SchemaVersion || contribs.TotalContributions != 5 || contribs.Restricted["2024-01-02"] != 1 {
+		t.Errorf("got %+v, want the contributions migrated to version %d", contribs, SchemaVersion)
+	}
+
+	// Problems in an old file are still reported on their line in it
+	data = strings.Replace(data, `"total_contributions": 5`, `"total_contributions": 6`, 1)
+
+	_, err = decodeContributions("contributions.json", []byte(data))
+
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 1 || invalid.Problems[0].Line != 5 {
+		t.Errorf("got error %v, want the wrong total on line 5", err)
+	}
+}
+
+func TestDecodeContributionsVersions(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"3", "only reads up to version 2; upgrade github-skyline"},
+		{"0", "invalid schema_version 0"},
+		{`"2"`, `invalid schema_version "2"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			data := strings.Replace(validContributionsFile, `"schema_version": 2`, `"schema_version": `+tt.version, 1)
+
+			_, err := decodeContributions("contributions.json", []byte(data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateContributions(t *testing.T) {
+	valid := &Contributions{ByDate: map[string]int{"2024-01-01": 1}}
+	valid.Recompute()
+
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := &Contributions{ByDate: map[string]int{"2024-01-01": -1, "24-1-2": 1}}
+
+	err := invalid.Validate()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("got error %v, want a ValidationError", err)
+	}
+
+	// Problems in contributions that weren't read from a file have no line
+	for _, problem := range validationErr.Problems {
+		if problem.Line != 0 {
+			t.Errorf("got %v on line %d, want no line", problem.Message, problem.Line)
+		}
+	}
+
+	for _, want := range []string{`invalid date "24-1-2"`, "negative count -1 on 2024-01-01", "first_date is \"\""} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
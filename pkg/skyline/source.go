@@ -0,0 +1,141 @@
+package skyline
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ContributionsSource provides contributions from a backend like the GitHub
+// API or a saved contributions file
+type ContributionsSource interface {
+	// FetchContributions returns the contributions between startYear and
+	// endYear (inclusive).  A year of 0 means the source picks the range.
+	FetchContributions(startYear, endYear int) (*Contributions, error)
+}
+
+// ContributionsUpdater is implemented by sources that can bring existing
+// contributions up to date without fetching everything again
+type ContributionsUpdater interface {
+	UpdateContributions(existing *Contributions, startYear, endYear int) (*Contributions, error)
+}
+
+// resolveYearRange returns the contribution years returned by discover,
+// narrowed to startYear and endYear where they are not 0.  If the user has no
+// contributions in the narrowed range, the start year is after the end year,
+// so there are no years to fetch and the user's contributions are empty
+// rather than failing a whole team.
+func resolveYearRange(startYear, endYear int, discover func() (int, int, error)) (int, int, error) {
+	if startYear != 0 && endYear != 0 && startYear > endYear {
+		return 0, 0, fmt.Errorf("invalid year range: %d-%d", startYear, endYear)
+	}
+
+	firstYear, lastYear, err := discover()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fmt.Printf("Found contribution years %d-%d\n", firstYear, lastYear)
+
+	if startYear == 0 || startYear < firstYear {
+		startYear = firstYear
+	}
+
+	if endYear == 0 || endYear > lastYear {
+		endYear = lastYear
+	}
+
+	if startYear > endYear {
+		fmt.Printf("No contributions in the requested years; there are only contributions in %d-%d\n", firstYear, lastYear)
+	}
+
+	return startYear, endYear, nil
+}
+
+// SourceConfig holds the settings a source is created with.  Each source only
+// uses the settings that apply to it.
+type SourceConfig struct {
+	// Usernames are the users to get contributions for; several users make a team
+	Usernames []string
+	// Team is the label for the contributions of several users
+	Team string
+	// Token authenticates with the backend
+	Token string
+	// Path is the file or directory the source reads from
+	Path string
+	// URL is the API endpoint or base URL of the backend
+	URL string
+	// Options are source specific settings
+	Options map[string]string
+	// GitHubOptions configure the GitHub API client
+	GitHubOptions []FetcherOption
+}
+
+// Option returns a source specific setting, or def if it is not set
+func (sc SourceConfig) Option(name, def string) string {
+	if value, ok := sc.Options[name]; ok && value != "" {
+		return value
+	}
+
+	return def
+}
+
+// Location returns the timezone in the "timezone" option, which sources bucket
+// timestamps into days in, or the local timezone if it is not set
+func (sc SourceConfig) Location() (*time.Location, error) {
+	loc, err := time.LoadLocation(sc.Option("timezone", "Local"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone option: %w", err)
+	}
+
+	return loc, nil
+}
+
+// SourceFactory creates a source from its settings
+type SourceFactory func(config SourceConfig) (ContributionsSource, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[string]SourceFactory)
+)
+
+// RegisterSource makes a source available by name to NewSource
+func RegisterSource(name string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	if _, exists := sources[name]; exists {
+		panic(fmt.Sprintf("source already registered: %s", name))
+	}
+
+	sources[name] = factory
+}
+
+// NewSource creates the source registered with the given name
+func NewSource(name string, config SourceConfig) (ContributionsSource, error) {
+	sourcesMu.RLock()
+	factory, ok := sources[name]
+	sourcesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("invalid source: %s; must be one of %v", name, SourceNames())
+	}
+
+	return factory(config)
+}
+
+// SourceNames returns the sorted names of the registered sources
+func SourceNames() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
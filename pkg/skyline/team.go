@@ -0,0 +1,515 @@
+package skyline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+)
+
+// NewTeamContributions sums the contributions of several users into a single
+// Contributions labeled with the team name.  The contributions of each member
+// are kept in Members so the team can be re-sliced later.
+func NewTeamContributions(team string, members ...*Contributions) *Contributions {
+	contrib := &Contributions{
+		Username: team,
+		ByDate:   make(map[string]int),
+		Members:  make(map[string]*Contributions, len(members)),
+	}
+
+	for _, member := range members {
+		contrib.Members[member.Username] = member
+
+		if contrib.Organization == "" {
+			contrib.Organization = member.Organization
+		}
+
+		if contrib.Timezone == "" {
+			contrib.Timezone = member.Timezone
+		}
+
+		for date, count := range member.ByDate {
+			contrib.ByDate[date] += count
+		}
+
+		for contribType, byDate := range member.ByType {
+			if contrib.ByType == nil {
+				contrib.ByType = make(map[ContributionType]map[string]int)
+			}
+
+			if contrib.ByType[contribType] == nil {
+				contrib.ByType[contribType] = make(map[string]int)
+			}
+
+			for date, count := range byDate {
+				contrib.ByType[contribType][date] += count
+			}
+		}
+
+		for year, count := range member.RestrictedByYear {
+			if contrib.RestrictedByYear == nil {
+				contrib.RestrictedByYear = make(map[int]int)
+			}
+
+			contrib.RestrictedByYear[year] += count
+		}
+
+		for date, count := range member.Restricted {
+			if contrib.Restricted == nil {
+				contrib.Restricted = make(map[string]int)
+			}
+
+			contrib.Restricted[date] += count
+		}
+
+		for date, hours := range member.ByHour {
+			if contrib.ByHour == nil {
+				contrib.ByHour = make(map[string][24]int)
+			}
+
+			sum := contrib.ByHour[date]
+			for hour, count := range hours {
+				sum[hour] += count
+			}
+			contrib.ByHour[date] = sum
+		}
+	}
+
+	contrib.Recompute()
+
+	return contrib
+}
+
+// IsTeam returns true if the contributions are the sum of several users
+func (c *Contributions) IsTeam() bool {
+	return len(c.Members) > 0
+}
+
+// MemberNames returns the sorted usernames of the team members
+func (c *Contributions) MemberNames() []string {
+	names := make([]string, 0, len(c.Members))
+	for name := range c.Members {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// OnlyMembers returns the team contributions of just the given members
+func (c *Contributions) OnlyMembers(usernames ...string) (*Contributions, error) {
+	usernames = UniqueUsernames(usernames)
+
+	members := make([]*Contributions, 0, len(usernames))
+	for _, username := range usernames {
+		member := c.member(username)
+		if member == nil {
+			return nil, fmt.Errorf("%s is not a member of %s; members are %v", username, c.Username, c.MemberNames())
+		}
+
+		members = append(members, member)
+	}
+
+	return NewTeamContributions(c.Username, members...), nil
+}
+
+// member returns the member with the username, which like on GitHub is case
+// insensitive, or nil if there is none
+func (c *Contributions) member(username string) *Contributions {
+	if member, ok := c.Members[username]; ok {
+		return member
+	}
+
+	for name, member := range c.Members {
+		if strings.EqualFold(name, username) {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// UniqueUsernames returns the usernames without duplicates, which like on
+// GitHub are case insensitive, keeping the first spelling of each
+func UniqueUsernames(usernames []string) []string {
+	unique := make([]string, 0, len(usernames))
+	seen := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		if key := strings.ToLower(username); !seen[key] {
+			seen[key] = true
+			unique = append(unique, username)
+		}
+	}
+
+	return unique
+}
+
+// Label returns the text used to identify whose contributions these are: the
+// repository, the team name or the @username
+func (c *Contributions) Label() string {
+	if c.Repository != "" {
+		return c.Repository
+	}
+
+	if c.IsTeam() {
+		return c.Username
+	}
+
+	return "@" + c.Username
+}
+
+// FetchTeamContributions fetches the contributions of each user and sums them
+// into a single Contributions labeled with the team name.  If existing is a
+// team, the members it already has are updated with UpdateContributions
+// instead of being fetched in full.
+func (gcf *GitHubContributionsFetcher) FetchTeamContributions(team string, usernames []string, existing *Contributions, startYear, endYear int) (*Contributions, error) {
+	usernames = UniqueUsernames(usernames)
+	members := make([]*Contributions, 0, len(usernames))
+
+	for i, username := range usernames {
+		fmt.Printf("Fetching contributions for %s (%d/%d)\n", username, i+1, len(usernames))
+
+		fetcher := gcf.forUser(username)
+
+		var member *Contributions
+		var err error
+		if existing != nil && existing.member(username) != nil {
+			member, err = fetcher.UpdateContributions(existing.member(username), startYear, endYear)
+		} else {
+			member, err = fetcher.FetchContributions(startYear, endYear)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("fetching contributions for %s: %w", username, err)
+		}
+
+		members = append(members, member)
+	}
+
+	return NewTeamContributions(team, members...), nil
+}
+
+// forUser returns a fetcher for another user that shares the same client
+func (gcf *GitHubContributionsFetcher) forUser(username string) *GitHubContributionsFetcher {
+	return &GitHubContributionsFetcher{
+		client:         gcf.client,
+		transport:      gcf.transport,
+		username:       username,
+		apiURL:         gcf.apiURL,
+		retryPolicy:    gcf.retryPolicy,
+		rootCAs:        gcf.rootCAs,
+		proxyURL:       gcf.proxyURL,
+		parallelism:    gcf.parallelism,
+		typeBreakdown:  gcf.typeBreakdown,
+		commitTimes:    gcf.commitTimes,
+		organization:   gcf.organization,
+		organizationID: gcf.organizationID,
+		location:       gcf.location,
+		cache:          gcf.cache,
+		tokenSource:    gcf.tokenSource,
+		rateLimit:      gcf.RateLimit(),
+	}
+}
+
+const (
+	// maxConsecutiveFailures aborts fetching an organization's members when
+	// the failures are more likely a problem with the token than the members
+	maxConsecutiveFailures = 5
+)
+
+// FetchOrganizationMembers returns the logins of all members of an organization
+func (gcf *GitHubContributionsFetcher) FetchOrganizationMembers(org string) ([]string, error) {
+	var query struct {
+		Organization *struct {
+			MembersWithRole struct {
+				TotalCount graphql.Int
+				PageInfo   struct {
+					HasNextPage graphql.Boolean
+					EndCursor   graphql.String
+				}
+				Nodes []struct {
+					Login graphql.String
+				}
+			} `graphql:"membersWithRole(first: 100, after: $cursor)"`
+		} `graphql:"organization(login: $login)"`
+	}
+
+	var variables = map[string]any{
+		"login":  graphql.String(org),
+		"cursor": (*graphql.String)(nil),
+	}
+
+	logins := []string{}
+	for {
+		if err := gcf.waitForRateLimit(context.Background()); err != nil {
+			return nil, err
+		}
+
+		err := gcf.query(context.Background(), &query, variables)
+		if err != nil {
+			return nil, fmt.Errorf("fetching members of %s: %w", org, err)
+		}
+
+		if query.Organization == nil {
+			return nil, &NotFoundError{Kind: "organization", Name: org}
+		}
+
+		members := query.Organization.MembersWithRole
+		for _, node := range members.Nodes {
+			logins = append(logins, string(node.Login))
+		}
+
+		fmt.Printf("Found %d/%d members of %s\n", len(logins), members.TotalCount, org)
+
+		if !members.PageInfo.HasNextPage {
+			break
+		}
+
+		cursor := members.PageInfo.EndCursor
+		variables["cursor"] = &cursor
+	}
+
+	return logins, nil
+}
+
+// FetchOrganizationContributions fetches the contributions of every member of
+// an organization and sums them into a single Contributions labeled with the
+// organization name.  Members that can't be fetched are skipped and returned
+// in failed.  If partialFile is not empty, each member is saved to it once it
+// is fetched, and any members already in it are not fetched again, so an
+// interrupted run can be resumed with the same settings.  If existing is a
+// team, the members it already has are updated with UpdateContributions
+// instead of being fetched in full, and members who left the organization are
+// dropped.
+func (gcf *GitHubContributionsFetcher) FetchOrganizationContributions(org string, existing *Contributions, partialFile string, startYear, endYear int) (contrib *Contributions, failed []string, err error) {
+	logins, err := gcf.FetchOrganizationMembers(org)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fetched := map[string]*Contributions{}
+
+	var partial *partialResults
+	if partialFile != "" {
+		partial, fetched, err = openPartialResults(partialFile, partialRun{
+			Organization: org,
+			Filter:       gcf.organization,
+			Timezone:     gcf.location.String(),
+			StartYear:    startYear,
+			EndYear:      endYear,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		defer partial.Close()
+	}
+
+	members := func() []*Contributions {
+		members := make([]*Contributions, 0, len(logins))
+		for _, login := range logins {
+			if member, ok := fetched[login]; ok {
+				members = append(members, member)
+			}
+		}
+		return members
+	}
+
+	consecutiveFailures := 0
+	for i, login := range logins {
+		if fetched[login] != nil {
+			continue
+		}
+
+		fmt.Printf("Fetching contributions for %s (%d/%d)\n", login, i+1, len(logins))
+
+		var member *Contributions
+		if existing != nil && existing.member(login) != nil {
+			member, err = gcf.forUser(login).UpdateContributions(existing.member(login), startYear, endYear)
+		} else {
+			member, err = gcf.forUser(login).FetchContributions(startYear, endYear)
+		}
+
+		if err != nil {
+			// Every other member would fail the same way
+			var badCredentials *BadCredentialsError
+			var scopes *InsufficientScopesError
+			if errors.As(err, &badCredentials) || errors.As(err, &scopes) || errors.Is(err, ErrNoToken) {
+				return nil, failed, err
+			}
+
+			fmt.Printf("Skipping %s: %v\n", login, err)
+			failed = append(failed, login)
+
+			consecutiveFailures++
+			if consecutiveFailures >= maxConsecutiveFailures {
+				return nil, failed, fmt.Errorf("giving up after %d consecutive failures: %w", consecutiveFailures, err)
+			}
+			continue
+		}
+
+		consecutiveFailures = 0
+		fetched[login] = member
+
+		if partial != nil {
+			if err := partial.add(member); err != nil {
+				return nil, failed, fmt.Errorf("saving partial results: %w", err)
+			}
+		}
+	}
+
+	return NewTeamContributions(org, members()...), failed, nil
+}
+
+// partialRun identifies the run that saved a partial results file, so only the
+// same run resumes it
+type partialRun struct {
+	Organization string `json:"organization"`
+	Filter       string `json:"filter,omitempty"`
+	Timezone     string `json:"timezone"`
+	StartYear    int    `json:"start_year"`
+	EndYear      int    `json:"end_year"`
+}
+
+func (pr partialRun) String() string {
+	years := "all years"
+	switch {
+	case pr.StartYear != 0 && pr.EndYear != 0:
+		years = fmt.Sprintf("%d-%d", pr.StartYear, pr.EndYear)
+	case pr.StartYear != 0:
+		years = fmt.Sprintf("%d onwards", pr.StartYear)
+	case pr.EndYear != 0:
+		years = fmt.Sprintf("up to %d", pr.EndYear)
+	}
+
+	text := fmt.Sprintf("%s (%s, %s", pr.Organization, years, pr.Timezone)
+	if pr.Filter != "" {
+		text += ", repositories of " + pr.Filter
+	}
+
+	return text + ")"
+}
+
+// partialResults saves the members of an organization as they are fetched: a
+// line with the partialRun, and then a line of JSON for each member, so saving
+// a member doesn't write the others again
+type partialResults struct {
+	file *os.File
+}
+
+// openPartialResults opens a partial results file for the run, returning the
+// members that are already in it.  A member cut off by an interrupted run is
+// dropped, and files saved by other runs are refused.
+func openPartialResults(file string, run partialRun) (*partialResults, map[string]*Contributions, error) {
+	fetched := map[string]*Contributions{}
+
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("loading partial results: %w", err)
+	}
+
+	if err == nil {
+		fetched, err = readPartialResults(file, data, run)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fmt.Printf("Resuming with %d members from %s\n", len(fetched), file)
+	}
+
+	// The members are rewritten without any that were cut off, to a temporary
+	// file first so an interrupted rewrite doesn't lose the saved members
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return nil, nil, fmt.Errorf("saving partial results: %w", err)
+	}
+
+	partial := &partialResults{file: tmp}
+
+	err = partial.write(run)
+	for _, login := range sortedKeys(fetched) {
+		if err == nil {
+			err = partial.add(fetched[login])
+		}
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, nil, fmt.Errorf("saving partial results: %w", err)
+	}
+
+	partial.file, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("saving partial results: %w", err)
+	}
+
+	return partial, fetched, nil
+}
+
+func readPartialResults(file string, data []byte, run partialRun) (map[string]*Contributions, error) {
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+
+	var saved partialRun
+	if err := json.Unmarshal(lines[0], &saved); err != nil || saved.Organization == "" {
+		return nil, fmt.Errorf("%s is not a partial results file; delete it to start over", file)
+	}
+
+	if saved != run {
+		return nil, fmt.Errorf("%s has partial results for %v, not %v; delete it to start over", file, saved, run)
+	}
+
+	fetched := map[string]*Contributions{}
+	for i, line := range lines[1:] {
+		member, err := decodeContributions(file, line)
+		if err != nil {
+			// Only the last member can be cut off by an interrupted run
+			if i == len(lines)-2 {
+				break
+			}
+
+			return nil, fmt.Errorf("loading partial results: %w", err)
+		}
+
+		fetched[member.Username] = member
+	}
+
+	return fetched, nil
+}
+
+// add saves a member
+func (pr *partialResults) add(member *Contributions) error {
+	member.SchemaVersion = SchemaVersion
+
+	return pr.write(member)
+}
+
+func (pr *partialResults) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = pr.file.Write(append(data, '\n'))
+
+	return err
+}
+
+func (pr *partialResults) Close() error {
+	return pr.file.Close()
+}
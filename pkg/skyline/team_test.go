@@ -0,0 +1,81 @@
+package skyline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartialResultsResume(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "someorg.json.partial")
+	run := partialRun{Organization: "someorg", Timezone: "UTC", StartYear: 2023, EndYear: 2024}
+
+	partial, fetched, err := openPartialResults(file, run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fetched) != 0 {
+		t.Errorf("got %d members from a new file, want none", len(fetched))
+	}
+
+	for _, username := range []string{"alice", "bob"} {
+		member := &Contributions{Username: username, Timezone: "UTC", ByDate: map[string]int{"2024-05-01": 2}}
+		member.Recompute()
+
+		if err := partial.add(member); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	partial.Close()
+
+	// An interrupted run can leave the last member cut off
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.WriteString(`{"username":"carol","by_da`)
+	out.Close()
+
+	partial, fetched, err = openPartialResults(file, run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	partial.Close()
+
+	if len(fetched) != 2 || fetched["alice"] == nil || fetched["bob"] == nil {
+		t.Errorf("got members %v, want alice and bob", sortedKeys(fetched))
+	}
+
+	// The rewrite replaces the file, without leaving its temporary file behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(file) {
+		t.Errorf("got files %v, want only %s", entries, filepath.Base(file))
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "carol") {
+		t.Errorf("the cut off member is still in the file:\n%s", data)
+	}
+
+	other := run
+	other.EndYear = 2025
+	if _, _, err := openPartialResults(file, other); err == nil || !strings.Contains(err.Error(), "delete it to start over") {
+		t.Errorf("got error %v for another run, want it refused", err)
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("the refused file was removed: %v", err)
+	}
+}
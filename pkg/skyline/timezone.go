@@ -0,0 +1,46 @@
+package skyline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalTimezone returns the name of the local timezone, like Europe/Berlin, from
+// the TZ environment variable or /etc/localtime.  It returns "Local" if the
+// name can't be found.
+func LocalTimezone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			if _, err := time.LoadLocation(name); err == nil {
+				return name
+			}
+		}
+	}
+
+	return "Local"
+}
+
+// Location returns the timezone the contributions were bucketed into days in,
+// or the local timezone if it wasn't recorded
+func (c *Contributions) Location() *time.Location {
+	if c.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			return loc
+		}
+	}
+
+	return time.Local
+}
+
+// today returns the current date in a location
+func today(loc *time.Location) string {
+	return time.Now().In(loc).Format("2006-01-02")
+}